@@ -20,6 +20,7 @@ var (
 	NotEnoughGold               = msError.NewError(11, errors.New("钻石不足"))
 	UserDataLocked              = msError.NewError(12, errors.New("用户数据被锁定"))
 	NotEnoughScore              = msError.NewError(13, errors.New("积分不足"))
+	RequestTooFrequent          = msError.NewError(14, errors.New("请求过于频繁"))
 	AccountOrPasswordError      = msError.NewError(101, errors.New("账号或密码错误"))
 	GetHallServersFail          = msError.NewError(102, errors.New("获取大厅服务器失败"))
 	AccountExist                = msError.NewError(103, errors.New("账号已存在"))
@@ -49,4 +50,7 @@ var (
 	RoomNotExist                = msError.NewError(308, errors.New("房间不存在"))
 	CanNotEnterNotLocation      = msError.NewError(309, errors.New("无法进入房间，获取定位信息失败"))
 	CanNotEnterTooNear          = msError.NewError(310, errors.New("无法进入房间，与房间中的其他玩家太近"))
+	ServerDraining              = msError.NewError(311, errors.New("服务器维护中，请稍后再创建房间"))
+	RoomMigrating               = msError.NewError(312, errors.New("房间正在迁移中"))
+	RoomMigrateFail             = msError.NewError(313, errors.New("房间迁移失败"))
 )
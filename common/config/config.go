@@ -23,9 +23,23 @@ type Config struct {
 	Domain     map[string]Domain       `mapstructure:"domain"`
 	Services   map[string]ServicesConf `mapstructure:"services"`
 	Server     ServerConf              `mapstructure:"server"`
+	Union      UnionConf               `mapstructure:"union"`
+	Trace      TraceConf               `mapstructure:"trace"`
+}
+
+// TraceConf 链路追踪span的导出
+type TraceConf struct {
+	Exporter string `mapstructure:"exporter"` //为空时不导出 file写入本地文件
+	File     string `mapstructure:"file"`     //file导出时的文件 为空时写入logs/{appName}-trace.json
+}
+
+// UnionConf game节点上联盟的生命周期
+type UnionConf struct {
+	IdleTime int `mapstructure:"idleTime"` //没有房间的联盟空闲多少秒后从内存中移除 0使用默认值
 }
 type ServerConf struct {
-	MaxConn int `mapstructure:"maxConn"`
+	MaxConn        int      `mapstructure:"maxConn"`
+	TrustedProxies []string `mapstructure:"trustedProxies"` //反向代理的IP或网段 只有来自这些地址的连接才使用X-Forwarded-For和X-Real-IP
 }
 
 type ServicesConf struct {
@@ -42,7 +56,19 @@ type JwtConf struct {
 	Exp    int64  `mapstructure:"exp"`
 }
 type LogConf struct {
-	Level string `mapstructure:"level"`
+	Level   string            `mapstructure:"level"`
+	Format  string            `mapstructure:"format"`  //text或json 为空时是text
+	Modules map[string]string `mapstructure:"modules"` //按模块设置级别 如room: DEBUG 模块名用小写
+	File    LogFileConf       `mapstructure:"file"`
+}
+
+// LogFileConf 日志写入文件 按大小和时间切割
+type LogFileConf struct {
+	Path           string `mapstructure:"path"`           //为空时输出到stderr
+	MaxSize        int    `mapstructure:"maxSize"`        //单个文件的上限 单位MB 为0时是100MB
+	MaxBackups     int    `mapstructure:"maxBackups"`     //保留的旧文件数 为0时全部保留
+	MaxAge         int    `mapstructure:"maxAge"`         //旧文件保留的天数 为0时不按时间清理
+	RotateInterval int    `mapstructure:"rotateInterval"` //按时间切割的间隔 单位秒 为0时只按大小切割
 }
 
 // Database 数据库配置
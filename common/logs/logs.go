@@ -2,23 +2,168 @@ package logs
 
 import (
 	"common/config"
+	"fmt"
 	"github.com/charmbracelet/log"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
 var logger *log.Logger
 
+// modules 单独设置了级别的模块 没有设置的模块使用logger的级别
+var modules sync.Map
+
+// rotateStop 停止上一次InitLog启动的定时切割
+var rotateStop chan struct{}
+
 func InitLog(appName string) {
-	logger = log.New(os.Stderr)
-	if config.Conf.Log.Level == "DEBUG" {
-		logger.SetLevel(log.DebugLevel)
-	} else {
-		logger.SetLevel(log.InfoLevel)
+	conf := config.Conf.Log
+	logger = log.New(output(conf.File))
+	logger.SetLevel(parseLevel(conf.Level, log.InfoLevel))
+	if conf.Format == "json" {
+		logger.SetFormatter(log.JSONFormatter)
 	}
 	logger.SetPrefix(appName)
 	logger.SetReportTimestamp(true)
 	logger.SetTimeFormat(time.DateTime)
+	modules.Range(func(key, value any) bool {
+		modules.Delete(key)
+		return true
+	})
+	for name, level := range conf.Modules {
+		ml := logger.With()
+		ml.SetLevel(parseLevel(level, logger.GetLevel()))
+		modules.Store(strings.ToLower(name), ml)
+	}
+}
+
+// output 配置了文件时写入文件 超过大小或者到了切割间隔时切割
+func output(conf config.LogFileConf) io.Writer {
+	if rotateStop != nil {
+		close(rotateStop)
+		rotateStop = nil
+	}
+	if conf.Path == "" {
+		return os.Stderr
+	}
+	w := &lumberjack.Logger{
+		Filename:   conf.Path,
+		MaxSize:    conf.MaxSize,
+		MaxBackups: conf.MaxBackups,
+		MaxAge:     conf.MaxAge,
+		LocalTime:  true,
+	}
+	if conf.RotateInterval > 0 {
+		stop := make(chan struct{})
+		rotateStop = stop
+		go func() {
+			ticker := time.NewTicker(time.Duration(conf.RotateInterval) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := w.Rotate(); err != nil {
+						logger.Errorf("rotate log err:%v", err)
+					}
+				case <-stop:
+					w.Close()
+					return
+				}
+			}
+		}()
+	}
+	return w
+}
+
+func parseLevel(level string, def log.Level) log.Level {
+	if level == "" {
+		return def
+	}
+	l, err := log.ParseLevel(level)
+	if err != nil {
+		return def
+	}
+	return l
+}
+
+// Logger 带上下文字段的日志 字段以key/value输出 json格式时是独立的字段
+type Logger struct {
+	module string
+	fields []any
+}
+
+// With 带上key/value字段 如logs.With("uid", uid).Error("xxx err:%v", err)
+func With(keyvals ...any) *Logger {
+	return &Logger{fields: keyvals}
+}
+
+// Module 模块的日志 级别可以在log.modules中单独设置
+func Module(name string) *Logger {
+	name = strings.ToLower(name)
+	return &Logger{module: name, fields: []any{"module", name}}
+}
+
+func (l *Logger) With(keyvals ...any) *Logger {
+	fields := make([]any, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	return &Logger{module: l.module, fields: fields}
+}
+
+func (l *Logger) base() *log.Logger {
+	if l.module != "" {
+		if ml, ok := modules.Load(l.module); ok {
+			return ml.(*log.Logger)
+		}
+	}
+	return logger
+}
+
+func (l *Logger) log(level log.Level, format string, values []any) {
+	base := l.base()
+	if base.GetLevel() > level {
+		return
+	}
+	msg := format
+	if len(values) > 0 {
+		msg = fmt.Sprintf(format, values...)
+	}
+	switch level {
+	case log.DebugLevel:
+		base.Debug(msg, l.fields...)
+	case log.InfoLevel:
+		base.Info(msg, l.fields...)
+	case log.WarnLevel:
+		base.Warn(msg, l.fields...)
+	case log.ErrorLevel:
+		base.Error(msg, l.fields...)
+	case log.FatalLevel:
+		base.Fatal(msg, l.fields...)
+	}
+}
+
+func (l *Logger) Fatal(format string, values ...any) {
+	l.log(log.FatalLevel, format, values)
+}
+
+func (l *Logger) Info(format string, values ...any) {
+	l.log(log.InfoLevel, format, values)
+}
+
+func (l *Logger) Warn(format string, values ...any) {
+	l.log(log.WarnLevel, format, values)
+}
+
+func (l *Logger) Debug(format string, values ...any) {
+	l.log(log.DebugLevel, format, values)
+}
+
+func (l *Logger) Error(format string, values ...any) {
+	l.log(log.ErrorLevel, format, values)
 }
 
 func Fatal(format string, values ...any) {
@@ -1,8 +1,12 @@
 package logs
 
 import (
+	"common/config"
+	"encoding/json"
 	"github.com/charmbracelet/log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -10,3 +14,39 @@ func TestError(t *testing.T) {
 	logger = log.New(os.Stderr)
 	Error("test:%v", 10)
 }
+
+func TestModuleLevelAndJSON(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "game.log")
+	config.Conf = &config.Config{Log: config.LogConf{
+		Level:   "INFO",
+		Format:  "json",
+		Modules: map[string]string{"room": "DEBUG"},
+		File:    config.LogFileConf{Path: file},
+	}}
+	InitLog("game")
+	defer func() { logger = log.New(os.Stderr) }()
+	Module("room").With("roomId", "100001").Debug("room debug %d", 1)
+	With("uid", "1001").Debug("hidden")
+	With("uid", "1001", "traceId", "abc").Info("user info")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read err:%v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines got %d: %s", len(lines), data)
+	}
+	var room, user map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &room); err != nil {
+		t.Fatalf("unmarshal err:%v", err)
+	}
+	if room["msg"] != "room debug 1" || room["module"] != "room" || room["roomId"] != "100001" {
+		t.Fatalf("unexpected room log %v", room)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &user); err != nil {
+		t.Fatalf("unmarshal err:%v", err)
+	}
+	if user["uid"] != "1001" || user["traceId"] != "abc" {
+		t.Fatalf("unexpected user log %v", user)
+	}
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"common/logs"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+const namespace = "msqp"
+
+var (
+	// ConnectorHandshakes 客户端握手次数
+	ConnectorHandshakes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "connector",
+		Name:      "handshakes_total",
+		Help:      "客户端握手次数",
+	})
+	// ConnectorHeartbeats 客户端心跳次数
+	ConnectorHeartbeats = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "connector",
+		Name:      "heartbeats_total",
+		Help:      "客户端心跳次数",
+	})
+	// MessagesIn 节点收到的nats消息 按路由统计
+	MessagesIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "node",
+		Name:      "messages_in_total",
+		Help:      "节点收到的nats消息数",
+	}, []string{"route"})
+	// MessagesOut 节点发出的nats消息 包括响应和推送 按路由统计
+	MessagesOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "node",
+		Name:      "messages_out_total",
+		Help:      "节点发出的nats消息数",
+	}, []string{"route"})
+	// HandlerDuration handler的处理耗时
+	HandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "node",
+		Name:      "handler_duration_seconds",
+		Help:      "handler的处理耗时",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"route"})
+	// SettlementFailures 结算失败次数 stage是失败的环节
+	SettlementFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "game",
+		Name:      "settlement_failures_total",
+		Help:      "结算失败次数",
+	}, []string{"game_type", "stage"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		ConnectorHandshakes,
+		ConnectorHeartbeats,
+		MessagesIn,
+		MessagesOut,
+		HandlerDuration,
+		SettlementFailures,
+	)
+}
+
+// RegisterGaugeFunc 抓取时调用fn得到当前值 比如connector的连接数
+func RegisterGaugeFunc(subsystem string, name string, help string, fn func() float64) {
+	register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
+
+// RegisterGaugeVecFunc 抓取时调用fn得到每个label值对应的当前值 比如按游戏类型统计的房间数
+func RegisterGaugeVecFunc(subsystem string, name string, help string, label string, fn func() map[string]float64) {
+	register(&gaugeVecFunc{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, []string{label}, nil),
+		fn:   fn,
+	})
+}
+
+// ObserveHandler 记录handler的处理耗时 用作node.Metrics中间件的回调
+func ObserveHandler(router string, cost time.Duration) {
+	HandlerDuration.WithLabelValues(router).Observe(cost.Seconds())
+}
+
+// register 同名的指标已经注册过时只记录日志 单进程模式下多个服务共用一个registry
+func register(c prometheus.Collector) {
+	if err := prometheus.Register(c); err != nil {
+		logs.Error("metrics register err:%v", err)
+	}
+}
+
+type gaugeVecFunc struct {
+	desc *prometheus.Desc
+	fn   func() map[string]float64
+}
+
+func (g *gaugeVecFunc) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+func (g *gaugeVecFunc) Collect(ch chan<- prometheus.Metric) {
+	for labelValue, v := range g.fn() {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, v, labelValue)
+	}
+}
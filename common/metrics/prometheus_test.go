@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+)
+
+func TestGaugeVecFunc(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(&gaugeVecFunc{
+		desc: prometheus.NewDesc("msqp_test_rooms", "test", []string{"game_type"}, nil),
+		fn: func() map[string]float64 {
+			return map[string]float64{"1": 3, "5": 2}
+		},
+	})
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 {
+		t.Fatalf("families = %d, want 1", len(families))
+	}
+	values := make(map[string]float64)
+	for _, m := range families[0].GetMetric() {
+		values[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+	}
+	if values["1"] != 3 || values["5"] != 2 {
+		t.Fatalf("values = %v", values)
+	}
+}
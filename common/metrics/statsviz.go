@@ -2,15 +2,17 @@ package metrics
 
 import (
 	"github.com/arl/statsviz"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
 )
 
-// Serve 可视化实时监控 /debug/statsviz
+// Serve 可视化实时监控 /debug/statsviz 和prometheus抓取的 /metrics
 func Serve(add string) error {
 	mux := http.NewServeMux()
 	if err := statsviz.Register(mux); err != nil {
 		return err
 	}
+	mux.Handle("/metrics", promhttp.Handler())
 	if err := http.ListenAndServe(add, mux); err != nil {
 		return err
 	}
@@ -0,0 +1,104 @@
+package trace
+
+import (
+	"common/config"
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"os"
+	"path/filepath"
+)
+
+const tracerName = "msqp"
+
+// ExporterFile span写入本地文件 每行一个json
+const ExporterFile = "file"
+
+// tracer 没有调用Init时不采样 仍然生成traceId和spanId 日志可以据此关联
+var tracer = sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.NeverSample())).Tracer(tracerName)
+
+// Init 初始化链路追踪的导出 conf.Exporter为空时不导出 返回停止时需要调用的方法 会把缓存的span写完
+func Init(serviceName string, conf config.TraceConf) (func(), error) {
+	if conf.Exporter == "" {
+		return func() {}, nil
+	}
+	if conf.Exporter != ExporterFile {
+		return nil, fmt.Errorf("unsupported trace exporter: %s", conf.Exporter)
+	}
+	file := conf.File
+	if file == "" {
+		file = filepath.Join("logs", serviceName+"-trace.json")
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	tracer = provider.Tracer(tracerName)
+	return func() {
+		provider.Shutdown(context.Background())
+		f.Close()
+	}, nil
+}
+
+// Span 一次处理的span 消息发往下一个节点时携带TraceId和SpanId
+type Span struct {
+	span oteltrace.Span
+}
+
+// Start 开始一个span traceId和parentId是上一个节点的链路 为空时开始新的链路
+func Start(name string, traceId string, parentId string) *Span {
+	ctx := context.Background()
+	tid, err1 := oteltrace.TraceIDFromHex(traceId)
+	sid, err2 := oteltrace.SpanIDFromHex(parentId)
+	if err1 == nil && err2 == nil {
+		ctx = oteltrace.ContextWithRemoteSpanContext(ctx, oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+			TraceID:    tid,
+			SpanID:     sid,
+			TraceFlags: oteltrace.FlagsSampled,
+			Remote:     true,
+		}))
+	}
+	_, span := tracer.Start(ctx, name)
+	return &Span{span: span}
+}
+
+func (s *Span) TraceId() string {
+	return s.span.SpanContext().TraceID().String()
+}
+
+func (s *Span) SpanId() string {
+	return s.span.SpanContext().SpanID().String()
+}
+
+// SetAttr 记录uid 路由等信息
+func (s *Span) SetAttr(key string, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+// SetError 处理失败时记录错误
+func (s *Span) SetError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *Span) End() {
+	s.span.End()
+}
@@ -0,0 +1,53 @@
+package trace
+
+import (
+	"common/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStartWithoutExporter(t *testing.T) {
+	root := Start("connector hall.userHandler.updateUserAddress", "", "")
+	defer root.End()
+	if len(root.TraceId()) != 32 || len(root.SpanId()) != 16 {
+		t.Fatalf("unexpected ids trace=%s span=%s", root.TraceId(), root.SpanId())
+	}
+	child := Start("hall-001 userHandler.updateUserAddress", root.TraceId(), root.SpanId())
+	defer child.End()
+	if child.TraceId() != root.TraceId() {
+		t.Fatalf("child trace %s != root trace %s", child.TraceId(), root.TraceId())
+	}
+	if child.SpanId() == root.SpanId() {
+		t.Fatalf("child span id should differ from parent")
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "trace.json")
+	shutdown, err := Init("test", config.TraceConf{Exporter: ExporterFile, File: file})
+	if err != nil {
+		t.Fatalf("init err:%v", err)
+	}
+	root := Start("connector game.roomHandler.roomMessageNotify", "", "")
+	child := Start("game-001 roomHandler.roomMessageNotify", root.TraceId(), root.SpanId())
+	child.SetAttr("uid", "1001")
+	child.End()
+	root.End()
+	shutdown()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read err:%v", err)
+	}
+	out := string(data)
+	if strings.Count(out, root.TraceId()) < 2 {
+		t.Fatalf("spans of the same trace not exported: %s", out)
+	}
+	if !strings.Contains(out, "game-001 roomHandler.roomMessageNotify") {
+		t.Fatalf("child span not exported: %s", out)
+	}
+	if _, err := Init("test", config.TraceConf{Exporter: "jaeger"}); err == nil {
+		t.Fatalf("expect unsupported exporter err")
+	}
+}
@@ -1,34 +1,57 @@
 package app
 
 import (
+	"common"
+	"common/biz"
 	"common/config"
 	"common/logs"
+	"common/trace"
+	"connector/handler"
 	"connector/route"
 	"context"
 	"core/repo"
 	"framework/connector"
+	"framework/net"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 )
 
+// NewConnector 创建注册好路由和中间件的connector 单进程模式也使用
+func NewConnector(manager *repo.Manager) *connector.Connector {
+	c := connector.Default()
+	c.RegisterHandler(route.Register(manager))
+	entryHandler := handler.NewEntryHandler(manager)
+	c.OnDisconnect(entryHandler.Disconnect)
+	c.OnSessionChange(entryHandler.SaveSession)
+	//IP哈希等按客户端IP的策略 只信任配置的反向代理转发的IP
+	c.TrustProxies(config.Conf.Server.TrustedProxies...)
+	c.Use(net.Recovery(), net.Logger())
+	c.UseRoute("entryHandler.", net.RateLimit(5, 10, common.F(biz.RequestTooFrequent)))
+	return c
+}
+
 // Run 启动程序 启动grpc服务 启用http服务  启用日志 启用数据库
 func Run(ctx context.Context, serverId string) error {
 	//1.做一个日志库 info error fatal debug
 	logs.InitLog(config.Conf.AppName)
+	shutdownTrace, err := trace.Init(config.Conf.AppName, config.Conf.Trace)
+	if err != nil {
+		logs.Error("init trace err:%v", err)
+		return err
+	}
 	exit := func() {}
 	go func() {
-		c := connector.Default()
+		c := NewConnector(repo.New())
 		exit = c.Close
-		manager := repo.New()
-		c.RegisterHandler(route.Register(manager))
 		c.Run(serverId, config.Conf.Server.MaxConn)
 	}()
 	stop := func() {
 		//other
 		exit()
 		time.Sleep(3 * time.Second)
+		shutdownTrace()
 		logs.Info("stop app finish")
 	}
 	//期望有一个优雅启停 遇到中断 退出 终止 挂断
@@ -13,11 +13,16 @@ import (
 	"encoding/json"
 	"framework/game"
 	"framework/net"
+	"framework/protocol"
 )
 
+// userReconnectNotify 对应game中的proto.UserReconnectNotify
+const userReconnectNotify = 312
+
 type EntryHandler struct {
-	userService  *service.UserService
-	redisService *service.RedisService
+	userService   *service.UserService
+	redisService  *service.RedisService
+	onlineService *service.OnlineService
 }
 
 func (h *EntryHandler) Entry(session *net.Session, body []byte) (any, error) {
@@ -45,6 +50,18 @@ func (h *EntryHandler) Entry(session *net.Session, body []byte) (any, error) {
 	if user.IsBlockedAccount {
 		return common.F(biz.BlockedAccount), nil
 	}
+	//同一账号只保留一个连接 顶掉其他地方的登录
+	h.bindOnline(session, uid)
+	//恢复断线前的session 还在房间中时通知房间重发数据 房间里的FrontendId也要指向新的connector
+	roomId := h.restoreSession(session, uid)
+	//房间号以mongo中的为准 断线期间房间可能已经解散 session中保存的是旧的房间号
+	if user.RoomID != roomId {
+		session.Put("roomId", user.RoomID)
+		h.SaveSession(session)
+	}
+	if user.RoomID != "" {
+		h.notifyRoomReconnect(session, user.RoomID)
+	}
 	//设置用户可以创建联盟
 	user.IsAgent = true
 	return common.S(map[string]any{
@@ -53,9 +70,94 @@ func (h *EntryHandler) Entry(session *net.Session, body []byte) (any, error) {
 	}), nil
 }
 
+func (h *EntryHandler) bindOnline(session *net.Session, uid string) {
+	connectorId := session.GetConnectorId()
+	old, err := h.onlineService.Bind(context.TODO(), uid, connectorId, session.Cid)
+	if err != nil {
+		logs.Error("bind online uid=%s err:%v", uid, err)
+		return
+	}
+	if old != nil && old.Cid != session.Cid {
+		logs.Info("uid=%s login elsewhere, kick old connection %s", uid, old)
+		session.KickConnection(old.ConnectorId, uid, old.Cid, protocol.KickDuplicateLogin)
+	}
+	if err := h.userService.UpdateUserFrontendId(context.TODO(), uid, connectorId); err != nil {
+		logs.Error("update frontendId uid=%s err:%v", uid, err)
+	}
+}
+
+// restoreSession 恢复断线前保存的session数据 返回其中的roomId
+func (h *EntryHandler) restoreSession(session *net.Session, uid string) string {
+	data, err := h.onlineService.LoadSession(context.TODO(), uid)
+	if err != nil {
+		logs.Error("load session uid=%s err:%v", uid, err)
+		return ""
+	}
+	if data == nil {
+		return ""
+	}
+	session.SetData(uid, data)
+	roomId, _ := data["roomId"].(string)
+	return roomId
+}
+
+// SaveSession 节点修改session数据后持久化 断线重连时恢复
+func (h *EntryHandler) SaveSession(session *net.Session) {
+	if session.Uid == "" {
+		return
+	}
+	err := h.onlineService.SaveSession(context.TODO(), session.Uid, session.Snapshot())
+	if err != nil {
+		logs.Error("save session uid=%s err:%v", session.Uid, err)
+	}
+}
+
+// notifyRoomReconnect 通知房间所在的game节点用户从新的connector重连
+func (h *EntryHandler) notifyRoomReconnect(session *net.Session, roomId string) {
+	dst, err := h.redisService.Get(context.TODO(), roomId)
+	if err != nil {
+		logs.Error("get room server roomId=%s err:%v", roomId, err)
+		return
+	}
+	if dst == "" {
+		//房间已经不存在了
+		return
+	}
+	data, err := session.GetSerializer().Marshal(map[string]any{"type": userReconnectNotify})
+	if err != nil {
+		logs.Error("marshal reconnect notify err:%v", err)
+		return
+	}
+	session.PushData(dst, "gameHandler.roomMessageNotify", &protocol.Message{
+		Type:  protocol.Notify,
+		Route: "game.gameHandler.roomMessageNotify",
+		Data:  data,
+	})
+}
+
+// Disconnect 连接断开时保存session并解除在线绑定
+func (h *EntryHandler) Disconnect(session *net.Session) {
+	if session.Uid == "" {
+		return
+	}
+	//被顶号的旧连接不能覆盖新连接的session
+	info, err := h.onlineService.Get(context.TODO(), session.Uid)
+	if err != nil {
+		logs.Error("get online uid=%s err:%v", session.Uid, err)
+	}
+	if info != nil && info.Cid == session.Cid {
+		h.SaveSession(session)
+	}
+	err = h.onlineService.Unbind(context.TODO(), session.Uid, session.GetConnectorId(), session.Cid)
+	if err != nil {
+		logs.Error("unbind online uid=%s err:%v", session.Uid, err)
+	}
+}
+
 func NewEntryHandler(r *repo.Manager) *EntryHandler {
 	return &EntryHandler{
-		userService:  service.NewUserService(r),
-		redisService: service.NewRedisService(r),
+		userService:   service.NewUserService(r),
+		redisService:  service.NewRedisService(r),
+		onlineService: service.NewOnlineService(r),
 	}
 }
@@ -0,0 +1,112 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"time"
+)
+
+const OnlineRedisKey = "Online"
+
+// unbindOnlineScript 只删除属于指定连接的绑定 避免旧连接断开时把新登录的绑定删掉
+var unbindOnlineScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// OnlineInfo 用户当前所在的connector和连接
+type OnlineInfo struct {
+	ConnectorId string
+	Cid         string
+}
+
+func (o *OnlineInfo) String() string {
+	return o.ConnectorId + "#" + o.Cid
+}
+
+func parseOnlineInfo(value string) *OnlineInfo {
+	connectorId, cid, ok := strings.Cut(value, "#")
+	if !ok {
+		return nil
+	}
+	return &OnlineInfo{ConnectorId: connectorId, Cid: cid}
+}
+
+func onlineKey(uid string) string {
+	return Prefix + ":" + OnlineRedisKey + ":" + uid
+}
+
+// client 单机和集群都实现了UniversalClient
+func (d *RedisDao) client() redis.UniversalClient {
+	if d.repo.Redis.Cli != nil {
+		return d.repo.Redis.Cli
+	}
+	return d.repo.Redis.ClusterCli
+}
+
+// SwapOnline 绑定uid到当前连接 返回之前的绑定 没有时返回nil
+func (d *RedisDao) SwapOnline(ctx context.Context, uid string, info *OnlineInfo) (*OnlineInfo, error) {
+	old, err := d.client().SetArgs(ctx, onlineKey(uid), info.String(), redis.SetArgs{Get: true}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseOnlineInfo(old), nil
+}
+
+func (d *RedisDao) GetOnline(ctx context.Context, uid string) (*OnlineInfo, error) {
+	value, err := d.client().Get(ctx, onlineKey(uid)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseOnlineInfo(value), nil
+}
+
+// DeleteOnline 只有绑定的还是这个连接时才删除
+func (d *RedisDao) DeleteOnline(ctx context.Context, uid string, info *OnlineInfo) error {
+	return unbindOnlineScript.Run(ctx, d.client(), []string{onlineKey(uid)}, info.String()).Err()
+}
+
+const SessionRedisKey = "Session"
+
+// SessionExpire 断线后session保留的时间 超过后重连需要重新进入房间
+const SessionExpire = 30 * time.Minute
+
+func sessionKey(uid string) string {
+	return Prefix + ":" + SessionRedisKey + ":" + uid
+}
+
+// SaveSession 保存连接的session数据 每次保存都会刷新过期时间
+func (d *RedisDao) SaveSession(ctx context.Context, uid string, data map[string]any) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return d.client().Set(ctx, sessionKey(uid), value, SessionExpire).Err()
+}
+
+// LoadSession 没有或已过期时返回nil
+func (d *RedisDao) LoadSession(ctx context.Context, uid string) (map[string]any, error) {
+	value, err := d.client().Get(ctx, sessionKey(uid)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]any
+	if err := json.Unmarshal(value, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
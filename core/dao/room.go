@@ -0,0 +1,216 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const RoomSnapshotRedisKey = "RoomSnapshot"
+const ServerRoomsRedisKey = "ServerRooms"
+
+// swapRoomServerScript 房间还在原来的游戏服上时才修改 避免覆盖其他流程写入的归属
+var swapRoomServerScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+func roomSnapshotKey(roomId string) string {
+	return Prefix + ":" + RoomSnapshotRedisKey + ":" + roomId
+}
+
+// serverRoomsKey 游戏服上所有有快照的房间号 重启时按节点恢复
+func serverRoomsKey(serverId string) string {
+	return Prefix + ":" + ServerRoomsRedisKey + ":" + serverId
+}
+
+// SaveRoomSnapshot 保存房间快照 并记录房间所在的游戏服
+func (d *RedisDao) SaveRoomSnapshot(ctx context.Context, serverId string, roomId string, data []byte) error {
+	_, err := d.client().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, roomSnapshotKey(roomId), data, 0)
+		pipe.SAdd(ctx, serverRoomsKey(serverId), roomId)
+		return nil
+	})
+	return err
+}
+
+// DeleteRoomSnapshot 房间解散后删除快照
+func (d *RedisDao) DeleteRoomSnapshot(ctx context.Context, serverId string, roomId string) error {
+	_, err := d.client().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, roomSnapshotKey(roomId))
+		pipe.SRem(ctx, serverRoomsKey(serverId), roomId)
+		return nil
+	})
+	return err
+}
+
+// LoadRoomSnapshots 读取游戏服上所有房间的快照 快照已经不存在的房间号顺便清理掉
+func (d *RedisDao) LoadRoomSnapshots(ctx context.Context, serverId string) (map[string][]byte, error) {
+	roomIds, err := d.client().SMembers(ctx, serverRoomsKey(serverId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make(map[string][]byte, len(roomIds))
+	for _, roomId := range roomIds {
+		data, err := d.client().Get(ctx, roomSnapshotKey(roomId)).Bytes()
+		if errors.Is(err, redis.Nil) {
+			d.client().SRem(ctx, serverRoomsKey(serverId), roomId)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		snapshots[roomId] = data
+	}
+	return snapshots, nil
+}
+
+// SwapRoomServer 房间迁移时修改房间所在的游戏服 房间已经不在from上时返回false
+func (d *RedisDao) SwapRoomServer(ctx context.Context, roomId string, from string, to string) (bool, error) {
+	n, err := swapRoomServerScript.Run(ctx, d.client(), []string{roomId}, from, to).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// MoveRoomSnapshot 房间迁移后快照归属到新的游戏服
+func (d *RedisDao) MoveRoomSnapshot(ctx context.Context, roomId string, from string, to string, data []byte) error {
+	_, err := d.client().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, roomSnapshotKey(roomId), data, 0)
+		pipe.SRem(ctx, serverRoomsKey(from), roomId)
+		pipe.SAdd(ctx, serverRoomsKey(to), roomId)
+		return nil
+	})
+	return err
+}
+
+const RoomIdRedisKey = "RoomId"
+
+// RoomIdExpire 房间号占用的过期时间 房间存在期间由游戏服定时续期 游戏服宕机后房间号最终会被回收
+const RoomIdExpire = 5 * time.Minute
+
+// claimRoomIdScript 房间号空闲或者属于ARGV[1]/ARGV[2]时改为属于ARGV[2]并续期
+// 续期和重启恢复时ARGV[1]和ARGV[2]相同 迁移时从ARGV[1]转给ARGV[2]
+var claimRoomIdScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == false or owner == ARGV[1] or owner == ARGV[2] then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// releaseRoomIdScript 只释放属于自己的房间号
+var releaseRoomIdScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func roomIdKey(roomId string) string {
+	return Prefix + ":" + RoomIdRedisKey + ":" + roomId
+}
+
+// ReserveRoomId 占用房间号 已经被其他房间占用时返回false
+func (d *RedisDao) ReserveRoomId(ctx context.Context, roomId string, serverId string) (bool, error) {
+	return d.client().SetNX(ctx, roomIdKey(roomId), serverId, RoomIdExpire).Result()
+}
+
+// GetRoomIdOwner 房间号所属的游戏服 没有被占用时返回空
+func (d *RedisDao) GetRoomIdOwner(ctx context.Context, roomId string) (string, error) {
+	return d.Get(ctx, roomIdKey(roomId))
+}
+
+// ClaimRoomId 续期或者转移房间号 房间号属于其他游戏服时返回false
+func (d *RedisDao) ClaimRoomId(ctx context.Context, roomId string, from string, to string) (bool, error) {
+	n, err := claimRoomIdScript.Run(ctx, d.client(), []string{roomIdKey(roomId)}, from, to, RoomIdExpire.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseRoomId 房间销毁后释放房间号 之后可以分配给新的房间
+func (d *RedisDao) ReleaseRoomId(ctx context.Context, roomId string, serverId string) error {
+	return releaseRoomIdScript.Run(ctx, d.client(), []string{roomIdKey(roomId)}, serverId).Err()
+}
+
+const UnionRoomsRedisKey = "UnionRooms"
+
+// UnionRoom 联盟房间目录中的房间 所有游戏服共享 用于房间列表和快速加入
+type UnionRoom struct {
+	RoomId     string          `json:"roomId"`
+	RuleId     string          `json:"ruleId"`
+	Seated     int             `json:"seated"`
+	MaxPlayers int             `json:"maxPlayers"`
+	Started    bool            `json:"started"`
+	Joinable   bool            `json:"joinable"`
+	ServerId   string          `json:"serverId"`
+	Info       json.RawMessage `json:"info"` // 房间列表展示的数据 由游戏服序列化
+}
+
+// removeUnionRoomScript 目录中的房间没有变化时才删除 避免删掉游戏服刚写入的新数据
+var removeUnionRoomScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call("HDEL", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+func unionRoomsKey(unionId int64) string {
+	return Prefix + ":" + UnionRoomsRedisKey + ":" + strconv.FormatInt(unionId, 10)
+}
+
+// SaveUnionRoom 更新联盟房间目录中的房间
+func (d *RedisDao) SaveUnionRoom(ctx context.Context, unionId int64, room *UnionRoom) error {
+	value, err := json.Marshal(room)
+	if err != nil {
+		return err
+	}
+	return d.client().HSet(ctx, unionRoomsKey(unionId), room.RoomId, value).Err()
+}
+
+// DeleteUnionRoom 房间解散后从目录中移除
+func (d *RedisDao) DeleteUnionRoom(ctx context.Context, unionId int64, roomId string) error {
+	return d.client().HDel(ctx, unionRoomsKey(unionId), roomId).Err()
+}
+
+// GetUnionRooms 联盟所有游戏服上的房间
+// 房间号已经不属于记录的游戏服时说明游戏服宕机没有恢复 这些房间顺便清理掉
+func (d *RedisDao) GetUnionRooms(ctx context.Context, unionId int64) ([]*UnionRoom, error) {
+	values, err := d.client().HGetAll(ctx, unionRoomsKey(unionId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	owners := make(map[string]*redis.StringCmd, len(values))
+	_, err = d.client().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for roomId := range values {
+			owners[roomId] = pipe.Get(ctx, roomIdKey(roomId))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	rooms := make([]*UnionRoom, 0, len(values))
+	for roomId, value := range values {
+		var room UnionRoom
+		if err := json.Unmarshal([]byte(value), &room); err == nil && owners[roomId].Val() == room.ServerId {
+			rooms = append(rooms, &room)
+			continue
+		}
+		removeUnionRoomScript.Run(ctx, d.client(), []string{unionRoomsKey(unionId)}, roomId, value)
+	}
+	return rooms, nil
+}
@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const UnionOwnerRedisKey = "UnionOwner"
+
+// UnionOwnerExpire 联盟归属的租约时间 持有的游戏服定时续期 宕机后过期由其他游戏服接管
+const UnionOwnerExpire = 30 * time.Second
+
+// acquireUnionOwnerScript 联盟没有归属或者属于自己时获得并续期 返回当前的归属
+var acquireUnionOwnerScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == false or owner == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return ARGV[1]
+end
+return owner
+`)
+
+// releaseUnionOwnerScript 只释放属于自己的联盟
+var releaseUnionOwnerScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func unionOwnerKey(unionId int64) string {
+	return Prefix + ":" + UnionOwnerRedisKey + ":" + strconv.FormatInt(unionId, 10)
+}
+
+// AcquireUnionOwner 获得或续期联盟的归属 已经属于其他游戏服时返回该游戏服
+func (d *RedisDao) AcquireUnionOwner(ctx context.Context, unionId int64, serverId string) (string, error) {
+	return acquireUnionOwnerScript.Run(ctx, d.client(), []string{unionOwnerKey(unionId)}, serverId, UnionOwnerExpire.Milliseconds()).Text()
+}
+
+// GetUnionOwner 联盟当前所在的游戏服 没有归属时返回空
+func (d *RedisDao) GetUnionOwner(ctx context.Context, unionId int64) (string, error) {
+	owner, err := d.client().Get(ctx, unionOwnerKey(unionId)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return owner, err
+}
+
+// ReleaseUnionOwner 排空时释放联盟 由其他游戏服接管
+func (d *RedisDao) ReleaseUnionOwner(ctx context.Context, unionId int64, serverId string) error {
+	return releaseUnionOwnerScript.Run(ctx, d.client(), []string{unionOwnerKey(unionId)}, serverId).Err()
+}
@@ -102,6 +102,18 @@ func (d *UserDao) UpdateUserRoomId(ctx context.Context, uid string, roomId strin
 	return err
 }
 
+func (d *UserDao) UpdateUserFrontendId(ctx context.Context, uid string, frontendId string) error {
+	db := d.repo.Mongo.Db.Collection("user")
+	_, err := db.UpdateOne(ctx, bson.M{
+		"uid": uid,
+	}, bson.M{
+		"$set": bson.M{
+			"frontendId": frontendId,
+		},
+	})
+	return err
+}
+
 func (d *UserDao) FindAndUpdate(ctx context.Context, matchData bson.M, saveData bson.M) (*entity.User, error) {
 	db := d.repo.Mongo.Db.Collection("user")
 	var user entity.User
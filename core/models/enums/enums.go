@@ -56,6 +56,7 @@ const (
 	BureauFinished                      = 1 //完成所有局
 	UserDismiss                         = 2 //用户解散
 	UnionOwnerDismiss                   = 3 //盟主解散
+	ServerDismiss                       = 4 //服务器停机解散
 )
 
 type CreatorType int
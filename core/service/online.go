@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"core/dao"
+	"core/repo"
+)
+
+// OnlineService 集群内uid到connector连接的注册表
+type OnlineService struct {
+	redisDao *dao.RedisDao
+}
+
+// Bind 登录时绑定当前连接 返回被顶掉的旧连接 没有时返回nil
+func (s *OnlineService) Bind(ctx context.Context, uid string, connectorId string, cid string) (*dao.OnlineInfo, error) {
+	return s.redisDao.SwapOnline(ctx, uid, &dao.OnlineInfo{ConnectorId: connectorId, Cid: cid})
+}
+
+// Unbind 连接断开时解绑 已经被新连接顶掉的不会影响新的绑定
+func (s *OnlineService) Unbind(ctx context.Context, uid string, connectorId string, cid string) error {
+	return s.redisDao.DeleteOnline(ctx, uid, &dao.OnlineInfo{ConnectorId: connectorId, Cid: cid})
+}
+
+// Get 查询用户当前所在的connector 不在线时返回nil
+func (s *OnlineService) Get(ctx context.Context, uid string) (*dao.OnlineInfo, error) {
+	return s.redisDao.GetOnline(ctx, uid)
+}
+
+// ConnectorId 用户当前所在的connector 不在线时返回空 节点踢人时使用
+func (s *OnlineService) ConnectorId(ctx context.Context, uid string) (string, error) {
+	info, err := s.Get(ctx, uid)
+	if err != nil || info == nil {
+		return "", err
+	}
+	return info.ConnectorId, nil
+}
+
+// SaveSession 持久化连接的session数据 断线重连时恢复
+func (s *OnlineService) SaveSession(ctx context.Context, uid string, data map[string]any) error {
+	return s.redisDao.SaveSession(ctx, uid, data)
+}
+
+// LoadSession 读取断线前保存的session数据 没有时返回nil
+func (s *OnlineService) LoadSession(ctx context.Context, uid string) (map[string]any, error) {
+	return s.redisDao.LoadSession(ctx, uid)
+}
+
+func NewOnlineService(r *repo.Manager) *OnlineService {
+	return &OnlineService{
+		redisDao: dao.NewRedisDao(r),
+	}
+}
@@ -22,6 +22,74 @@ func (s *RedisService) Delete(key string) error {
 	return s.redisDao.Delete(context.TODO(), key)
 }
 
+// SaveRoomSnapshot 保存房间快照 游戏服重启后恢复房间
+func (s *RedisService) SaveRoomSnapshot(ctx context.Context, serverId string, roomId string, data []byte) error {
+	return s.redisDao.SaveRoomSnapshot(ctx, serverId, roomId, data)
+}
+
+func (s *RedisService) DeleteRoomSnapshot(ctx context.Context, serverId string, roomId string) error {
+	return s.redisDao.DeleteRoomSnapshot(ctx, serverId, roomId)
+}
+
+// LoadRoomSnapshots 游戏服上所有房间的快照 key是房间号
+func (s *RedisService) LoadRoomSnapshots(ctx context.Context, serverId string) (map[string][]byte, error) {
+	return s.redisDao.LoadRoomSnapshots(ctx, serverId)
+}
+
+// SwapRoomServer 房间迁移 只有房间还在from上时才改为to
+func (s *RedisService) SwapRoomServer(ctx context.Context, roomId string, from string, to string) (bool, error) {
+	return s.redisDao.SwapRoomServer(ctx, roomId, from, to)
+}
+
+func (s *RedisService) MoveRoomSnapshot(ctx context.Context, roomId string, from string, to string, data []byte) error {
+	return s.redisDao.MoveRoomSnapshot(ctx, roomId, from, to, data)
+}
+
+// ReserveRoomId 占用集群内唯一的房间号
+func (s *RedisService) ReserveRoomId(ctx context.Context, roomId string, serverId string) (bool, error) {
+	return s.redisDao.ReserveRoomId(ctx, roomId, serverId)
+}
+
+// ClaimRoomId 续期房间号 from和to不同时将房间号转给to
+func (s *RedisService) ClaimRoomId(ctx context.Context, roomId string, from string, to string) (bool, error) {
+	return s.redisDao.ClaimRoomId(ctx, roomId, from, to)
+}
+
+func (s *RedisService) GetRoomIdOwner(ctx context.Context, roomId string) (string, error) {
+	return s.redisDao.GetRoomIdOwner(ctx, roomId)
+}
+
+func (s *RedisService) ReleaseRoomId(ctx context.Context, roomId string, serverId string) error {
+	return s.redisDao.ReleaseRoomId(ctx, roomId, serverId)
+}
+
+// SaveUnionRoom 房间状态变化时更新联盟房间目录
+func (s *RedisService) SaveUnionRoom(ctx context.Context, unionId int64, room *dao.UnionRoom) error {
+	return s.redisDao.SaveUnionRoom(ctx, unionId, room)
+}
+
+func (s *RedisService) DeleteUnionRoom(ctx context.Context, unionId int64, roomId string) error {
+	return s.redisDao.DeleteUnionRoom(ctx, unionId, roomId)
+}
+
+// GetUnionRooms 联盟在所有游戏服上的房间
+func (s *RedisService) GetUnionRooms(ctx context.Context, unionId int64) ([]*dao.UnionRoom, error) {
+	return s.redisDao.GetUnionRooms(ctx, unionId)
+}
+
+// AcquireUnionOwner 获得或续期联盟的归属 返回联盟当前所在的游戏服
+func (s *RedisService) AcquireUnionOwner(ctx context.Context, unionId int64, serverId string) (string, error) {
+	return s.redisDao.AcquireUnionOwner(ctx, unionId, serverId)
+}
+
+func (s *RedisService) GetUnionOwner(ctx context.Context, unionId int64) (string, error) {
+	return s.redisDao.GetUnionOwner(ctx, unionId)
+}
+
+func (s *RedisService) ReleaseUnionOwner(ctx context.Context, unionId int64, serverId string) error {
+	return s.redisDao.ReleaseUnionOwner(ctx, unionId, serverId)
+}
+
 func NewRedisService(r *repo.Manager) *RedisService {
 	return &RedisService{
 		redisDao: dao.NewRedisDao(r),
@@ -6,9 +6,16 @@ import (
 	"core/dao"
 	"core/models/entity"
 	"core/repo"
+	"framework/remote"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// UnionChangedSubject 联盟数据变化的广播地址 所有game节点订阅 收到后重新加载联盟数据
+const UnionChangedSubject = "game.unionChanged"
+
+// UnionChangedRoute game节点处理联盟数据变化的路由
+const UnionChangedRoute = "unionHandler.unionChanged"
+
 type UnionService struct {
 	unionDao *dao.UnionDao
 }
@@ -26,6 +33,14 @@ func (s *UnionService) FindUnionAndUpdate(ctx context.Context, matchData bson.M,
 	return s.unionDao.FindAndUpdate(ctx, matchData, saveData)
 }
 
+// NotifyUnionChanged 联盟数据修改后通知所有game节点重新加载 避免game节点上的联盟数据过期
+func (s *UnionService) NotifyUnionChanged(unionId int64, session *remote.Session) {
+	err := session.Notify(UnionChangedSubject, UnionChangedRoute, map[string]any{"unionID": unionId})
+	if err != nil {
+		logs.Error("NotifyUnionChanged err:%v, unionId=%d", err, unionId)
+	}
+}
+
 func NewUnionService(r *repo.Manager) *UnionService {
 	return &UnionService{
 		unionDao: dao.NewUnionDao(r),
@@ -142,6 +142,16 @@ func (s *UserService) UpdateUserRoomId(ctx context.Context, uid string, roomId s
 	return nil
 }
 
+// UpdateUserFrontendId 记录用户当前所在的connector 推送时使用
+func (s *UserService) UpdateUserFrontendId(ctx context.Context, uid string, frontendId string) error {
+	err := s.userDao.UpdateUserFrontendId(ctx, uid, frontendId)
+	if err != nil {
+		logs.Error("UpdateUserFrontendId err : %v", err)
+		return biz.SqlError
+	}
+	return nil
+}
+
 func (s *UserService) UpdateUserDataScoreInc(uid string, unionID int64, score int) *entity.User {
 	ctx := context.Background()
 	matchData := bson.M{"unionInfo.unionID": unionID, "uid": uid}
@@ -2,6 +2,7 @@ package connector
 
 import (
 	"common/logs"
+	"common/metrics"
 	"fmt"
 	"framework/game"
 	"framework/net"
@@ -9,15 +10,21 @@ import (
 )
 
 type Connector struct {
-	isRunning bool
-	wsManager *net.Manager
-	handlers  net.LogicHandler
-	remoteCli remote.Client
+	isRunning       bool
+	wsManager       *net.Manager
+	handlers        net.LogicHandler
+	remoteCli       remote.Client
+	middlewares     []net.RouteMiddleware
+	newClient       remote.ClientBuilder
+	onDisconnect    []func(session *net.Session)
+	onSessionChange []func(session *net.Session)
+	trustedProxies  []string
 }
 
 func Default() *Connector {
 	return &Connector{
-		handlers: make(net.LogicHandler),
+		handlers:  make(net.LogicHandler),
+		newClient: remote.NatsClientBuilder,
 	}
 }
 
@@ -25,9 +32,15 @@ func (c *Connector) Run(serverId string, maxConn int) {
 	if !c.isRunning {
 		//启动websocket和nats
 		c.wsManager = net.NewManager(maxConn)
-		c.wsManager.ConnectorHandlers = c.handlers
+		metrics.RegisterGaugeFunc("connector", "connections", "当前的websocket连接数", func() float64 {
+			return float64(c.wsManager.GetConnectionCount())
+		})
+		c.wsManager.ConnectorHandlers = c.handlers.Wrap(c.middlewares)
+		c.wsManager.OnDisconnect = c.onDisconnect
+		c.wsManager.OnSessionChange = c.onSessionChange
+		c.wsManager.SetTrustedProxies(c.trustedProxies)
 		//启动nats nats server不会存储消息
-		c.remoteCli = remote.NewNatsClient(serverId, c.wsManager.RemoteReadChan)
+		c.remoteCli = c.newClient(serverId, c.wsManager.RemoteReadChan)
 		c.remoteCli.Run()
 		c.wsManager.RemoteCli = c.remoteCli
 		c.Serve(serverId)
@@ -54,6 +67,38 @@ func (c *Connector) Serve(serverId string) {
 	c.wsManager.Run(addr)
 }
 
+// SetClientBuilder 替换节点间通信的客户端 比如单进程模式下使用remote.LocalBus 需要在Run之前调用
+func (c *Connector) SetClientBuilder(builder remote.ClientBuilder) {
+	c.newClient = builder
+}
+
 func (c *Connector) RegisterHandler(handlers net.LogicHandler) {
 	c.handlers = handlers
 }
+
+// OnDisconnect 连接断开时回调 需要在Run之前注册
+func (c *Connector) OnDisconnect(fn func(session *net.Session)) {
+	c.onDisconnect = append(c.onDisconnect, fn)
+}
+
+// OnSessionChange 节点修改session数据后回调 需要在Run之前注册
+func (c *Connector) OnSessionChange(fn func(session *net.Session)) {
+	c.onSessionChange = append(c.onSessionChange, fn)
+}
+
+// TrustProxies 可信的反向代理 来自这些地址的连接使用X-Forwarded-For中的客户端IP 需要在Run之前设置
+func (c *Connector) TrustProxies(proxies ...string) {
+	c.trustedProxies = append(c.trustedProxies, proxies...)
+}
+
+// Use 对所有本地handler生效的中间件 先注册的在最外层
+func (c *Connector) Use(middleware ...net.Middleware) {
+	c.UseRoute("", middleware...)
+}
+
+// UseRoute 只对指定前缀的路由生效 比如 "entryHandler." 需要在Run之前注册
+func (c *Connector) UseRoute(prefix string, middleware ...net.Middleware) {
+	for _, m := range middleware {
+		c.middlewares = append(c.middlewares, net.RouteMiddleware{Prefix: prefix, Middleware: m})
+	}
+}
@@ -27,6 +27,7 @@ type ServersConf struct {
 	Nats       NatsConfig         `json:"nats" `
 	Connector  []*ConnectorConfig `json:"connector" `
 	Servers    []*ServersConfig   `json:"servers" `
+	Compress   CompressConfig     `json:"compress" `
 	TypeServer map[string][]*ServersConfig
 }
 
@@ -36,6 +37,8 @@ type ServersConfig struct {
 	HandleTimeOut    int    `json:"handleTimeOut" `
 	RPCTimeOut       int    `json:"rpcTimeOut" `
 	MaxRunRoutineNum int    `json:"maxRunRoutineNum" `
+	Weight           int    `json:"weight" `       //负载均衡权重 0按1处理
+	DrainTimeOut     int    `json:"drainTimeOut" ` //停机时等待牌局结束的秒数 0使用默认值
 }
 
 type ConnectorConfig struct {
@@ -45,6 +48,14 @@ type ConnectorConfig struct {
 	Frontend   bool   `json:"frontend" `
 	ServerType string `json:"serverType" `
 }
+
+// CompressConfig 消息体zlib压缩配置 客户端握手时声明支持才会对该连接启用
+type CompressConfig struct {
+	Enable    bool `json:"enable" `
+	Threshold int  `json:"threshold" ` //消息体达到多少字节才压缩
+	Level     int  `json:"level" `     //zlib压缩级别 1-9 0为默认级别
+}
+
 type NatsConfig struct {
 	Url string `json:"url" mapstructure:"url"`
 }
@@ -75,11 +86,13 @@ func readServersConfig(configFile string) {
 	v.WatchConfig()
 	v.OnConfigChange(func(in fsnotify.Event) {
 		log.Println("serversConfig 配置文件被修改了")
-		err := v.Unmarshal(&serversConfig)
+		var changed ServersConf
+		err := v.Unmarshal(&changed)
 		if err != nil {
 			panic(fmt.Errorf("serversConfig Unmarshal change config data,err:%v \n", err))
 		}
-		Conf.ServersConf = serversConfig
+		Conf.ServersConf = changed
+		typeServersConfig()
 	})
 	err := v.ReadInConfig()
 	if err != nil {
@@ -94,18 +107,13 @@ func readServersConfig(configFile string) {
 	typeServersConfig()
 }
 
+// typeServersConfig 按类型分组 配置修改后重新生成
 func typeServersConfig() {
-	if len(Conf.ServersConf.Servers) > 0 {
-		if Conf.ServersConf.TypeServer == nil {
-			Conf.ServersConf.TypeServer = make(map[string][]*ServersConfig)
-		}
-		for _, v := range Conf.ServersConf.Servers {
-			if Conf.ServersConf.TypeServer[v.ServerType] == nil {
-				Conf.ServersConf.TypeServer[v.ServerType] = make([]*ServersConfig, 0)
-			}
-			Conf.ServersConf.TypeServer[v.ServerType] = append(Conf.ServersConf.TypeServer[v.ServerType], v)
-		}
+	typeServer := make(map[string][]*ServersConfig)
+	for _, v := range Conf.ServersConf.Servers {
+		typeServer[v.ServerType] = append(typeServer[v.ServerType], v)
 	}
+	Conf.ServersConf.TypeServer = typeServer
 }
 
 func readGameConfig(configFile string) {
@@ -157,6 +165,15 @@ func (c *Config) GetConnector(serverId string) *ConnectorConfig {
 	return nil
 }
 
+func (c *Config) GetServersConfig(serverId string) *ServersConfig {
+	for _, v := range c.ServersConf.Servers {
+		if v.ID == serverId {
+			return v
+		}
+	}
+	return nil
+}
+
 func (c *Config) GetConnectorByServerType(serverType string) *ConnectorConfig {
 	for _, v := range c.ServersConf.Connector {
 		if v.ServerType == serverType {
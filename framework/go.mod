@@ -1,2 +1,17 @@
 module framework
-go 1.21.0
\ No newline at end of file
+
+go 1.21.0
+
+require (
+	github.com/go-playground/validator/v10 v10.14.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/time v0.5.0
+)
+
+require (
+	github.com/gabriel-vasile/mimetype v1.4.2 // indirect
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/leodido/go-urn v1.2.4 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+)
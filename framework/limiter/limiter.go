@@ -0,0 +1,58 @@
+package limiter
+
+import (
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+// idleTimeout key超过这个时间没有请求就清理掉
+const idleTimeout = 10 * time.Minute
+
+type entry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// KeyLimiter 按key(uid、连接id)限流的令牌桶
+type KeyLimiter struct {
+	sync.Mutex
+	limit     rate.Limit
+	burst     int
+	limiters  map[string]*entry
+	lastClean time.Time
+}
+
+// NewKeyLimiter 每个key每秒r个请求 允许突发burst个
+func NewKeyLimiter(r float64, burst int) *KeyLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &KeyLimiter{
+		limit:     rate.Limit(r),
+		burst:     burst,
+		limiters:  make(map[string]*entry),
+		lastClean: time.Now(),
+	}
+}
+
+func (l *KeyLimiter) Allow(key string) bool {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastClean) > idleTimeout {
+		for k, v := range l.limiters {
+			if now.Sub(v.lastSeen) > idleTimeout {
+				delete(l.limiters, k)
+			}
+		}
+		l.lastClean = now
+	}
+	e, ok := l.limiters[key]
+	if !ok {
+		e = &entry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[key] = e
+	}
+	e.lastSeen = now
+	return e.limiter.AllowN(now, 1)
+}
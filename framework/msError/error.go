@@ -6,6 +6,23 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// 节点间rpc调用的错误码 业务错误码见common/biz
+var (
+	RPCFail            = NewError(500, errors.New("rpc调用失败"))
+	RPCTimeout         = NewError(501, errors.New("rpc调用超时"))
+	RPCNoResponders    = NewError(502, errors.New("rpc目标服务不可用"))
+	RPCHandlerNotFound = NewError(503, errors.New("rpc路由不存在"))
+	HandleTimeout      = NewError(504, errors.New("请求处理超时"))
+	ServerBusy         = NewError(505, errors.New("服务器繁忙"))
+	ServerError        = NewError(506, errors.New("服务器内部错误"))
+)
+
+// Result 框架直接回复客户端的错误结果 和common.Result的结构保持一致 客户端按code处理
+type Result struct {
+	Code int `json:"code"`
+	Msg  any `json:"msg"`
+}
+
 type Error struct {
 	Code int
 	Err  error
@@ -25,6 +42,17 @@ func NewError(code int, err error) *Error {
 func GrpcError(err *Error) error {
 	return status.Error(codes.Code(err.Code), err.Err.Error())
 }
+
+// CodeError 根据错误码还原Error 用于rpc响应
+func CodeError(code int, msg string) *Error {
+	for _, v := range []*Error{RPCFail, RPCTimeout, RPCNoResponders, RPCHandlerNotFound, HandleTimeout, ServerBusy, ServerError} {
+		if v.Code == code {
+			return v
+		}
+	}
+	return NewError(code, errors.New(msg))
+}
+
 func ToError(err error) *Error {
 	fromError, _ := status.FromError(err)
 	return NewError(int(fromError.Code()), errors.New(fromError.Message()))
@@ -1,9 +1,12 @@
 package net
 
+import "framework/protocol"
+
 type Connection interface {
 	Close()
 	SendMessage(buf []byte) error
 	GetSession() *Session
+	GetDictionary() *protocol.Dictionary
 }
 
 type MsgPack struct {
@@ -0,0 +1,87 @@
+package net
+
+import (
+	"common/logs"
+	"encoding/json"
+	"framework/game"
+	"framework/registry"
+	"framework/stream"
+	"time"
+)
+
+// serverHeartbeat 收到节点心跳 新上线且还没有路由的节点向它查询路由
+func (m *Manager) serverHeartbeat(msg *stream.Msg) {
+	//connector之间不转发请求
+	if msg.Server != nil && msg.Server.ServerType == registry.ConnectorType {
+		return
+	}
+	if msg.Load != nil {
+		m.UpdateServerLoad(msg.Src, msg.Load.Score())
+	}
+	added := m.Registry.Update(msg.Server, time.Now())
+	m.Registry.SetDraining(msg.Src, msg.Draining)
+	if !added {
+		return
+	}
+	logs.Info("server online, serverId=%s", msg.Src)
+	m.routeLock.RLock()
+	_, ok := m.serverRoutes[msg.Src]
+	m.routeLock.RUnlock()
+	if !ok {
+		m.queryRoutes(msg.Src)
+	}
+}
+
+// serverLeave 节点主动下线 不再向它转发请求
+func (m *Manager) serverLeave(serverId string) {
+	if m.Registry.Remove(serverId) {
+		logs.Info("server offline, serverId=%s", serverId)
+	}
+	m.removeServerRoutes(serverId)
+	m.removeServerLoad(serverId)
+}
+
+// sweepServers 定时移除心跳超时的节点 同时广播connector自己的心跳
+func (m *Manager) sweepServers() {
+	m.sendHeartbeat()
+	ticker := time.NewTicker(registry.HeartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.sendHeartbeat()
+		for _, serverId := range m.Registry.Sweep(time.Now()) {
+			logs.Warn("server heartbeat timeout, serverId=%s", serverId)
+			m.removeServerRoutes(serverId)
+			m.removeServerLoad(serverId)
+		}
+	}
+}
+
+func (m *Manager) removeServerRoutes(serverId string) {
+	m.routeLock.Lock()
+	_, ok := m.serverRoutes[serverId]
+	delete(m.serverRoutes, serverId)
+	m.routeLock.Unlock()
+	if ok {
+		m.rebuildDictionary()
+	}
+}
+
+func (m *Manager) removeServerLoad(serverId string) {
+	m.lbState.mu.Lock()
+	defer m.lbState.mu.Unlock()
+	delete(m.lbState.serverLoads, serverId)
+}
+
+// sendHeartbeat 节点据此找到存活的connector 比如踢人时在线注册表中查不到用户
+func (m *Manager) sendHeartbeat() {
+	msg := &stream.Msg{
+		Src:         m.ServerId,
+		Dst:         registry.Subject,
+		SessionType: stream.Heartbeat,
+		Server:      &game.ServersConfig{ID: m.ServerId, ServerType: registry.ConnectorType},
+	}
+	data, _ := json.Marshal(msg)
+	if err := m.RemoteCli.SendMsg(registry.Subject, data); err != nil {
+		logs.Error("connector send heartbeat err:%v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package net
+
+import (
+	"framework/limiter"
+	"framework/msError"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Middleware 包装connector本地的handler router为handler注册的路由
+type Middleware func(router string, next HandlerFunc) HandlerFunc
+
+// RouteMiddleware Prefix为空时对所有路由生效
+type RouteMiddleware struct {
+	Prefix     string
+	Middleware Middleware
+}
+
+// Wrap 为每个路由生成中间件链 先注册的在最外层
+func (h LogicHandler) Wrap(middlewares []RouteMiddleware) LogicHandler {
+	if len(middlewares) == 0 {
+		return h
+	}
+	handlers := make(LogicHandler, len(h))
+	for router, handler := range h {
+		fn := handler
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			if strings.HasPrefix(router, middlewares[i].Prefix) {
+				fn = middlewares[i].Middleware(router, fn)
+			}
+		}
+		handlers[router] = fn
+	}
+	return handlers
+}
+
+// Recovery handler panic时返回服务器错误 避免整个进程退出
+func Recovery() Middleware {
+	return func(router string, next HandlerFunc) HandlerFunc {
+		return func(session *Session, body []byte) (result any, err error) {
+			defer func() {
+				if e := recover(); e != nil {
+					session.Logger().With("route", router).Error("connector handler panic err:%v\n%s", e, debug.Stack())
+					result, err = msError.Result{Code: msError.ServerError.Code}, nil
+				}
+			}()
+			return next(session, body)
+		}
+	}
+}
+
+// Logger 记录请求的路由、连接和耗时
+func Logger() Middleware {
+	return func(router string, next HandlerFunc) HandlerFunc {
+		return func(session *Session, body []byte) (any, error) {
+			start := time.Now()
+			result, err := next(session, body)
+			session.Logger().With("route", router).Info("connector handler cost=%v, err:%v", time.Since(start), err)
+			return result, err
+		}
+	}
+}
+
+// Auth 没有登录的连接直接返回fail entry之外的路由使用
+func Auth(fail any) Middleware {
+	return func(router string, next HandlerFunc) HandlerFunc {
+		return func(session *Session, body []byte) (any, error) {
+			if session.Uid == "" {
+				session.Logger().With("route", router).Warn("connector handler auth fail")
+				return fail, nil
+			}
+			return next(session, body)
+		}
+	}
+}
+
+// RateLimit 按连接限流 每秒r个请求 允许突发burst个 超出返回fail
+func RateLimit(r float64, burst int, fail any) Middleware {
+	l := limiter.NewKeyLimiter(r, burst)
+	return func(router string, next HandlerFunc) HandlerFunc {
+		return func(session *Session, body []byte) (any, error) {
+			if !l.Allow(session.Cid) {
+				session.Logger().With("route", router).Warn("connector handler rate limited")
+				return fail, nil
+			}
+			return next(session, body)
+		}
+	}
+}
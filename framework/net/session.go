@@ -10,22 +10,84 @@ import (
 
 type Session struct {
 	sync.RWMutex
-	Cid     string
-	Uid     string
-	data    map[string]any
-	all     map[string]any
-	manager *Manager
+	Cid        string
+	Uid        string
+	data       map[string]any
+	all        map[string]any
+	manager    *Manager
+	serializer protocol.Serializer
+	compress   bool
+	ip         string
+	pinned     map[string]string // serverType -> 固定转发的节点
 }
 
 func NewSession(cid string, manager *Manager) *Session {
 	return &Session{
-		Cid:     cid,
-		data:    make(map[string]any),
-		all:     make(map[string]any),
-		manager: manager,
+		Cid:        cid,
+		data:       make(map[string]any),
+		all:        make(map[string]any),
+		manager:    manager,
+		serializer: protocol.DefaultSerializer(),
+		pinned:     make(map[string]string),
 	}
 }
 
+// Logger 带上连接的cid和uid
+func (s *Session) Logger() *logs.Logger {
+	return logs.With("cid", s.Cid, "uid", s.Uid)
+}
+
+// SetIP 建立连接时记录客户端IP IP哈希策略使用
+func (s *Session) SetIP(ip string) {
+	s.Lock()
+	defer s.Unlock()
+	s.ip = ip
+}
+
+func (s *Session) GetIP() string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.ip
+}
+
+func (s *Session) pin(serverType string, serverId string) {
+	s.Lock()
+	defer s.Unlock()
+	s.pinned[serverType] = serverId
+}
+
+func (s *Session) pinnedDst(serverType string) string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.pinned[serverType]
+}
+
+// SetSerializer 握手时设置当前连接使用的消息体编码
+func (s *Session) SetSerializer(serializer protocol.Serializer) {
+	s.Lock()
+	defer s.Unlock()
+	s.serializer = serializer
+}
+
+func (s *Session) GetSerializer() protocol.Serializer {
+	s.RLock()
+	defer s.RUnlock()
+	return s.serializer
+}
+
+// SetCompress 握手时根据客户端能力和配置决定是否压缩消息体
+func (s *Session) SetCompress(compress bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.compress = compress
+}
+
+func (s *Session) IsCompress() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.compress
+}
+
 func (s *Session) Put(key string, v any) {
 	s.Lock()
 	defer s.Unlock()
@@ -46,6 +108,18 @@ func (s *Session) SetData(uid string, data map[string]any) {
 		}
 	}
 }
+
+// Snapshot 当前连接的session数据副本 用于持久化
+func (s *Session) Snapshot() map[string]any {
+	s.RLock()
+	defer s.RUnlock()
+	data := make(map[string]any, len(s.data))
+	for k, v := range s.data {
+		data[k] = v
+	}
+	return data
+}
+
 func (s *Session) SetAll(data map[string]any) {
 	s.Lock()
 	defer s.Unlock()
@@ -67,6 +141,7 @@ func (s *Session) PushData(dst string, router string, message *protocol.Message)
 			SingleData: s.data,
 			AllData:    s.all,
 		},
+		Serializer: s.GetSerializer().Name(),
 	}
 	data, _ := json.Marshal(msg)
 	err := s.manager.RemoteCli.SendMsg(dst, data)
@@ -75,6 +150,31 @@ func (s *Session) PushData(dst string, router string, message *protocol.Message)
 	}
 }
 
+// GetConnectorId 当前连接所在的connector
+func (s *Session) GetConnectorId() string {
+	return s.manager.ServerId
+}
+
+// KickConnection 踢掉指定connector上的某个连接 在当前connector上时直接处理
+func (s *Session) KickConnection(connectorId string, uid string, cid string, reason protocol.KickReason) {
+	if connectorId == s.manager.ServerId {
+		s.manager.KickCid(cid, reason)
+		return
+	}
+	msg := &stream.Msg{
+		Cid:         cid,
+		Uid:         uid,
+		Src:         s.manager.ServerId,
+		Dst:         connectorId,
+		SessionType: stream.Kick,
+		KickReason:  reason,
+	}
+	data, _ := json.Marshal(msg)
+	if err := s.manager.RemoteCli.SendMsg(connectorId, data); err != nil {
+		logs.Error("kick connection err:%v", err)
+	}
+}
+
 func (s *Session) Close() {
 	s.Lock()
 	defer s.Unlock()
@@ -0,0 +1,100 @@
+package net
+
+import (
+	"common/logs"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// sessionDst 选择转发的节点 一致性哈希和IP哈希策略下同一连接固定转发到第一次选择的节点
+// 节点下线或排空后重新选择
+func (m *Manager) sessionDst(session *Session, serverType string) (string, error) {
+	m.lbState.mu.RLock()
+	strategy := m.lbState.strategy
+	m.lbState.mu.RUnlock()
+	//一致性哈希在登录前只能按IP选择 登录后再固定
+	sticky := strategy == IPHash || (strategy == ConsistentHash && session.Uid != "")
+	if sticky {
+		if dst := session.pinnedDst(serverType); dst != "" && m.Registry.Available(dst) {
+			return dst, nil
+		}
+	}
+	dst, err := m.selectDst(serverType, session.Uid, session.GetIP())
+	if err != nil {
+		return "", err
+	}
+	if sticky {
+		session.pin(serverType, dst)
+	}
+	return dst, nil
+}
+
+// resetHashRing 节点上下线后丢弃旧的哈希环 下次选择时按存活的节点重建
+func (m *Manager) resetHashRing(serverType string) {
+	m.lbState.mu.Lock()
+	defer m.lbState.mu.Unlock()
+	delete(m.lbState.hashRing, serverType)
+}
+
+// SetTrustedProxies 设置可信的反向代理 支持IP和CIDR 需要在Run之前设置
+func (m *Manager) SetTrustedProxies(proxies []string) {
+	m.trustedProxies = m.trustedProxies[:0]
+	for _, v := range proxies {
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				logs.Error("parse trusted proxy err:%v", err)
+				continue
+			}
+			m.trustedProxies = append(m.trustedProxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			logs.Error("parse trusted proxy err:%v", err)
+			continue
+		}
+		m.trustedProxies = append(m.trustedProxies, prefix.Masked())
+	}
+}
+
+func (m *Manager) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range m.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP 连接来自可信的代理时使用代理转发的真实IP 否则请求头可以被客户端伪造
+// X-Forwarded-For从右往左取第一个不是可信代理的地址
+func (m *Manager) clientIP(r *http.Request) string {
+	host := r.RemoteAddr
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	host = strings.Trim(host, "[]")
+	if !m.trusted(host) {
+		return host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		ips := strings.Split(forwarded, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if ip != "" && (i == 0 || !m.trusted(ip)) {
+				return ip
+			}
+		}
+	}
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+	return host
+}
@@ -0,0 +1,79 @@
+package net
+
+import (
+	"common/config"
+	"common/logs"
+	"framework/game"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSessionDstSticky(t *testing.T) {
+	config.Conf = new(config.Config)
+	logs.InitLog("net")
+	m := NewManager(10)
+	now := time.Now()
+	for _, id := range []string{"hall-001", "hall-002", "hall-003"} {
+		m.Registry.Update(&game.ServersConfig{ID: id, ServerType: "hall"}, now)
+	}
+	m.SetLoadBalanceStrategy(ConsistentHash)
+	session := NewSession("c1", m)
+	session.Uid = "10001"
+	dst, err := m.sessionDst(session, "hall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if next, _ := m.sessionDst(session, "hall"); next != dst {
+			t.Fatalf("session should be pinned to %s, got %s", dst, next)
+		}
+	}
+	//固定的节点下线后重新选择 哈希环不再包含下线的节点
+	m.Registry.Remove(dst)
+	next, err := m.sessionDst(session, "hall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == dst || m.Registry.Get(next) == nil {
+		t.Fatalf("expected a live server other than %s, got %s", dst, next)
+	}
+	for i := 0; i < 100; i++ {
+		other := NewSession("c2", m)
+		other.Uid = time.Duration(i).String()
+		if got, _ := m.sessionDst(other, "hall"); got == dst {
+			t.Fatalf("removed server %s still in hash ring", dst)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	m := &Manager{}
+	r := &http.Request{RemoteAddr: "10.0.0.1:5000", Header: http.Header{}}
+	if ip := m.clientIP(r); ip != "10.0.0.1" {
+		t.Fatalf("unexpected ip %s", ip)
+	}
+	//不是可信代理的连接 请求头可以伪造 直接使用连接地址
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 10.0.0.1")
+	r.Header.Set("X-Real-IP", "1.2.3.4")
+	if ip := m.clientIP(r); ip != "10.0.0.1" {
+		t.Fatalf("untrusted forwarded ip used %s", ip)
+	}
+	m.SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "bad"})
+	if len(m.trustedProxies) != 2 {
+		t.Fatalf("unexpected trusted proxies %v", m.trustedProxies)
+	}
+	if ip := m.clientIP(r); ip != "1.2.3.4" {
+		t.Fatalf("unexpected forwarded ip %s", ip)
+	}
+	//客户端自己带上的X-Forwarded-For在最左边 取最右边不是代理的地址
+	r.Header.Set("X-Forwarded-For", "6.6.6.6, 1.2.3.4, 10.0.0.2")
+	if ip := m.clientIP(r); ip != "1.2.3.4" {
+		t.Fatalf("spoofed forwarded ip used %s", ip)
+	}
+	r.Header.Del("X-Forwarded-For")
+	r.RemoteAddr = "[::ffff:192.168.1.1]:5000"
+	if ip := m.clientIP(r); ip != "1.2.3.4" {
+		t.Fatalf("unexpected real ip %s", ip)
+	}
+}
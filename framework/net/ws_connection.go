@@ -2,8 +2,10 @@ package net
 
 import (
 	"common/logs"
+	"framework/protocol"
 	"github.com/gorilla/websocket"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,6 +25,7 @@ type WsConnection struct {
 	ReadChan      chan *MsgPack
 	WriteChan     chan []byte
 	Session       *Session
+	dictionary    atomic.Pointer[protocol.Dictionary] // 握手时下发给客户端的路由字典 nil表示不启用路由压缩
 	pingTicker    *time.Ticker
 	closeChan     chan struct{}
 	closeOnce     sync.Once
@@ -34,6 +37,14 @@ func (c *WsConnection) GetSession() *Session {
 	return c.Session
 }
 
+func (c *WsConnection) GetDictionary() *protocol.Dictionary {
+	return c.dictionary.Load()
+}
+
+func (c *WsConnection) SetDictionary(dict *protocol.Dictionary) {
+	c.dictionary.Store(dict)
+}
+
 func (c *WsConnection) SendMessage(buf []byte) error {
 	c.WriteChan <- buf
 	return nil
@@ -94,10 +105,15 @@ func (c *WsConnection) writeMessage() {
 				c.Close()
 				return
 			}
-			logs.Warn("%v", string(message))
+			logs.With("cid", c.Cid).Debug("client write message size=%d", len(message))
 			if err := c.Conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
 				logs.Error("client[%s] write stream err :%v", c.Cid, err)
 			}
+			//Kick包写出后断开连接
+			if len(message) > 0 && protocol.PackageType(message[0]) == protocol.Kick {
+				c.Close()
+				return
+			}
 		case <-c.pingTicker.C:
 			if err := c.Conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
 				logs.Error("client[%s] ping SetWriteDeadline err :%v", c.Cid, err)
@@ -139,7 +155,7 @@ func (c *WsConnection) readMessage() {
 				}
 				return
 			}
-			logs.Warn("receive====%v", string(message))
+			logs.With("cid", c.Cid).Debug("client read message size=%d", len(message))
 			//客户端发来的消息是二进制消息
 			if messageType == websocket.BinaryMessage {
 				select {
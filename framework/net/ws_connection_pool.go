@@ -111,6 +111,7 @@ func (c *WsConnection) reset() {
 	c.ReadChan = nil
 	c.WriteChan = nil
 	c.Session = nil
+	c.dictionary.Store(nil)
 	c.pingTicker = nil
 	c.closeChan = nil
 }
@@ -2,19 +2,22 @@ package net
 
 import (
 	"common/logs"
+	"common/metrics"
+	"common/trace"
 	"common/utils"
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"framework/game"
 	"framework/protocol"
+	"framework/registry"
 	"framework/remote"
 	"framework/stream"
 	"github.com/gorilla/websocket"
 	"hash/fnv"
 	"math/rand"
 	"net/http"
+	"net/netip"
 	"runtime"
 	"sort"
 	"strings"
@@ -100,6 +103,22 @@ type Manager struct {
 
 	// 负载均衡状态
 	lbState loadBalanceState
+
+	// 可信的反向代理 只有来自这些地址的连接才读取请求头中的真实IP
+	trustedProxies []netip.Prefix
+
+	// 路由压缩字典 由connector和各节点注册的handler生成
+	routeLock    sync.RWMutex
+	serverRoutes map[string][]string // serverId -> 节点通告的路由
+	dictionary   *protocol.Dictionary
+
+	// 连接断开回调 比如清理在线注册表
+	OnDisconnect []func(session *Session)
+	// 节点修改session数据后回调 比如持久化session
+	OnSessionChange []func(session *Session)
+
+	// 存活的节点 由节点心跳维护 转发请求时从中选择
+	Registry *registry.Registry
 }
 type HandlerFunc func(session *Session, body []byte) (any, error)
 type LogicHandler map[string]HandlerFunc
@@ -114,16 +133,26 @@ func (m *Manager) Run(addr string) {
 	go m.clientReadChanHandler()
 	go m.remoteReadChanHandler()
 	go m.remotePushChanHandler()
+	go m.sweepServers()
 
 	// 启动性能监控
 	go m.monitorPerformance()
 
-	http.HandleFunc("/", m.serveWS)
+	//每个connector使用自己的mux 单进程模式下启动多个connector不会重复注册
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", m.serveWS)
 	//设置不同的消息处理器
 	m.setupEventHandlers()
+	//生成路由字典 订阅广播地址 向节点查询已注册的路由和存活状态
+	m.rebuildDictionary()
+	m.Registry.Seed(game.Conf.ServersConf.Servers, time.Now())
+	if err := m.RemoteCli.Subscribe(registry.Subject); err != nil {
+		logs.Error("subscribe discovery err:%v", err)
+	}
+	m.QueryRoutes()
 	logs.Info("WebSocket manager started with %d worker goroutines and %d connection buckets",
 		m.workerCount, len(m.clientBuckets))
-	logs.Fatal("connector listen serve err:%v", http.ListenAndServe(addr, nil))
+	logs.Fatal("connector listen serve err:%v", http.ListenAndServe(addr, mux))
 }
 
 // 工作协程处理消息
@@ -201,6 +230,7 @@ func (m *Manager) serveWS(w http.ResponseWriter, r *http.Request) {
 
 	// 创建客户端连接
 	client := NewWsConnection(wsConn, m)
+	client.GetSession().SetIP(m.clientIP(r))
 
 	// 记录连接成功
 	logs.Debug("WebSocket connection established: %s from %s", client.Cid, r.RemoteAddr)
@@ -295,6 +325,11 @@ func (m *Manager) removeClient(wc *WsConnection) {
 		delete(bucket.clients, wc.Cid)
 		bucket.Unlock()
 
+		// 关闭前回调 此时session中的uid还在
+		for _, fn := range m.OnDisconnect {
+			fn(wc.GetSession())
+		}
+
 		// 关闭连接
 		wc.Close()
 
@@ -326,14 +361,23 @@ func (m *Manager) clientReadChanHandler() {
 }
 
 func (m *Manager) decodeClientPack(body *MsgPack) {
-	//解析协议
-	packet, err := protocol.Decode(body.Body)
+	bucket := m.getBucket(body.Cid)
+	bucket.RLock()
+	conn, ok := bucket.clients[body.Cid]
+	bucket.RUnlock()
+	if !ok {
+		atomic.AddInt64(&m.stats.messageErrors, 1)
+		logs.Error("decode stream err:no client found, cid=%s", body.Cid)
+		return
+	}
+	//解析协议 使用该连接握手时下发的路由字典
+	packet, err := protocol.Decode(body.Body, conn.GetDictionary())
 	if err != nil {
 		atomic.AddInt64(&m.stats.messageErrors, 1)
 		logs.Error("decode stream err:%v", err)
 		return
 	}
-	if err := m.routeEvent(packet, body.Cid); err != nil {
+	if err := m.routeEvent(packet, conn); err != nil {
 		atomic.AddInt64(&m.stats.messageErrors, 1)
 		logs.Error("routeEvent err:%v", err)
 	}
@@ -373,18 +417,8 @@ func (m *Manager) Close() {
 	logs.Info("All connections closed")
 }
 
-func (m *Manager) routeEvent(packet *protocol.Packet, cid string) error {
+func (m *Manager) routeEvent(packet *protocol.Packet, conn Connection) error {
 	// 根据packet.type来做不同的处理
-	bucket := m.getBucket(cid)
-
-	bucket.RLock()
-	conn, ok := bucket.clients[cid]
-	bucket.RUnlock()
-
-	if !ok {
-		return errors.New("no client found")
-	}
-
 	handler, ok := m.handlers[packet.Type]
 	if !ok {
 		return errors.New("no packetType found")
@@ -402,10 +436,34 @@ func (m *Manager) setupEventHandlers() {
 }
 
 func (m *Manager) HandshakeHandler(packet *protocol.Packet, c Connection) error {
+	metrics.ConnectorHandshakes.Inc()
+	//客户端选择消息体的编码方式 不支持的回退到json 在响应中告知客户端最终使用的编码
+	serializer := protocol.DefaultSerializer()
+	compress := false
+	if body := packet.HandshakeBody(); body != nil {
+		if s, ok := protocol.GetSerializer(body.Sys.Serializer); ok {
+			serializer = s
+		} else {
+			logs.Warn("client[%s] unsupported serializer:%s, fallback to %s",
+				c.GetSession().Cid, body.Sys.Serializer, serializer.Name())
+		}
+		//客户端声明支持 并且服务端开启了压缩
+		compress = body.Sys.Compress && game.Conf.ServersConf.Compress.Enable
+	}
+	c.GetSession().SetSerializer(serializer)
+	c.GetSession().SetCompress(compress)
+	//路由字典由服务端生成 客户端发来的字典忽略 每个连接持有握手时的字典
+	dict := m.GetDictionary()
+	if wc, ok := c.(*WsConnection); ok {
+		wc.SetDictionary(dict)
+	}
 	res := protocol.HandshakeResponse{
 		Code: 200,
 		Sys: protocol.Sys{
-			Heartbeat: 3,
+			Heartbeat:  3,
+			Serializer: serializer.Name(),
+			Compress:   compress,
+			Dict:       dict.Routes(),
 		},
 	}
 	data, _ := json.Marshal(res)
@@ -422,6 +480,7 @@ func (m *Manager) HandshakeAckHandler(packet *protocol.Packet, c Connection) err
 }
 
 func (m *Manager) HeartbeatHandler(packet *protocol.Packet, c Connection) error {
+	metrics.ConnectorHeartbeats.Inc()
 	var res []byte
 	data, _ := json.Marshal(res)
 	buf, err := protocol.Encode(packet.Type, data)
@@ -442,23 +501,33 @@ func (m *Manager) MessageHandler(packet *protocol.Packet, c Connection) error {
 	}
 	serverType := routers[0]
 	handlerMethod := fmt.Sprintf("%s.%s", routers[1], routers[2])
+	//客户端请求是链路的起点 后续节点的span都挂在这个span下
+	span := trace.Start("connector "+routeStr, "", "")
+	span.SetAttr("uid", c.GetSession().Uid)
+	span.SetAttr("cid", c.GetSession().Cid)
+	defer span.End()
 	connectorConfig := game.Conf.GetConnectorByServerType(serverType)
 	if connectorConfig != nil {
 		//本地connector服务器处理
 		handler, ok := m.ConnectorHandlers[handlerMethod]
 		if ok {
-			data, err := handler(c.GetSession(), message.Data)
+			//connector的handler统一按json解析请求
+			serializer := c.GetSession().GetSerializer()
+			body, err := protocol.Transcode(message.Data, serializer, protocol.DefaultSerializer())
 			if err != nil {
 				return err
 			}
-			marshal, _ := json.Marshal(data)
-			message.Type = protocol.Response
-			message.Data = marshal
-			encode, err := protocol.MessageEncode(message)
+			data, err := handler(c.GetSession(), body)
 			if err != nil {
 				return err
 			}
-			res, err := protocol.Encode(packet.Type, encode)
+			marshal, err := serializer.Marshal(data)
+			if err != nil {
+				return err
+			}
+			message.Type = protocol.Response
+			message.Data = marshal
+			res, err := m.encodeResponse(message, serializer, c)
 			if err != nil {
 				return err
 			}
@@ -466,7 +535,7 @@ func (m *Manager) MessageHandler(packet *protocol.Packet, c Connection) error {
 		}
 	} else {
 		//nats 远端调用处理 hall.userHandler.updateUserAddress
-		dst, err := m.selectDst(serverType)
+		dst, err := m.sessionDst(c.GetSession(), serverType)
 		if err != nil {
 			logs.Error("remote send stream selectDst err:%v", err)
 			return err
@@ -483,22 +552,62 @@ func (m *Manager) MessageHandler(packet *protocol.Packet, c Connection) error {
 				SingleData: c.GetSession().data,
 				AllData:    c.GetSession().all,
 			},
+			Serializer: c.GetSession().GetSerializer().Name(),
+			TraceId:    span.TraceId(),
+			SpanId:     span.SpanId(),
 		}
 		data, _ := json.Marshal(msg)
-		logs.Warn("remote send stream:%s", string(msg.Body.Data))
+		logs.With("uid", msg.Uid, "cid", msg.Cid, "route", routeStr, "traceId", msg.TraceId).Debug("remote send stream dst=%s, size=%d", dst, len(msg.Body.Data))
 		err = m.RemoteCli.SendMsg(dst, data)
 		if err != nil {
 			logs.Error("remote send stream err：%v", err)
+			span.SetError(err)
 			return err
 		}
 	}
 	return nil
 }
 
+// KickHandler 客户端发送Kick包表示主动断开连接
 func (m *Manager) KickHandler(packet *protocol.Packet, c Connection) error {
+	logs.Info("client[%s] uid=%s kick by client", c.GetSession().Cid, c.GetSession().Uid)
+	c.Close()
 	return nil
 }
 
+// Kick 将当前connector上的用户踢下线 用户不在当前connector时返回false
+func (m *Manager) Kick(uid string, reason protocol.KickReason) bool {
+	c := m.FindClientByUID(uid)
+	if c == nil {
+		return false
+	}
+	return m.KickConnection(c, reason) == nil
+}
+
+// KickCid 按连接踢下线 同一用户重复登录时只踢旧连接
+func (m *Manager) KickCid(cid string, reason protocol.KickReason) bool {
+	bucket := m.getBucket(cid)
+	bucket.RLock()
+	c, ok := bucket.clients[cid]
+	bucket.RUnlock()
+	if !ok {
+		return false
+	}
+	return m.KickConnection(c, reason) == nil
+}
+
+// KickConnection 发送Kick包 写出后断开连接
+func (m *Manager) KickConnection(c Connection, reason protocol.KickReason) error {
+	buf, err := protocol.EncodeKick(reason)
+	if err != nil {
+		logs.Error("encode kick packet err:%v", err)
+		c.Close()
+		return err
+	}
+	logs.Info("client[%s] uid=%s kicked, reason=%s", c.GetSession().Cid, c.GetSession().Uid, reason)
+	return c.SendMessage(buf)
+}
+
 func (m *Manager) remoteReadChanHandler() {
 	const batchSize = 32
 	batch := make([][]byte, 0, batchSize)
@@ -521,6 +630,30 @@ func (m *Manager) remoteReadChanHandler() {
 					return
 				}
 
+				if msg.SessionType == stream.RouteAnnounce {
+					m.updateServerRoutes(msg.Src, msg.Routes)
+					return
+				}
+
+				if msg.SessionType == stream.Heartbeat {
+					m.serverHeartbeat(&msg)
+					return
+				}
+
+				if msg.SessionType == stream.ServerLeave {
+					m.serverLeave(msg.Src)
+					return
+				}
+
+				if msg.SessionType == stream.Kick {
+					if msg.Cid != "" {
+						m.KickCid(msg.Cid, msg.KickReason)
+					} else {
+						m.Kick(msg.Uid, msg.KickReason)
+					}
+					return
+				}
+
 				if msg.SessionType == stream.Session {
 					//需要特出处理，session类型是存储在connection中的session 并不 推送客户端
 					m.setSessionData(msg)
@@ -528,6 +661,9 @@ func (m *Manager) remoteReadChanHandler() {
 				}
 
 				if msg.Body != nil {
+					//回给客户端的消息挂在请求的链路下 推送没有上游链路时单独开始
+					span := trace.Start("connector send "+msg.Body.Route, msg.TraceId, msg.SpanId)
+					defer span.End()
 					if msg.Body.Type == protocol.Request || msg.Body.Type == protocol.Response {
 						//给客户端回信息 都是 response
 						msg.Body.Type = protocol.Response
@@ -576,6 +712,55 @@ func (m *Manager) remoteReadChanHandler() {
 	}
 }
 
+// QueryRoutes 广播查询所有节点已注册的路由 节点收到后会回复心跳和routeAnnounce
+func (m *Manager) QueryRoutes() {
+	m.queryRoutes(registry.Subject)
+}
+
+func (m *Manager) queryRoutes(dst string) {
+	msg := &stream.Msg{
+		Src:         m.ServerId,
+		Dst:         dst,
+		SessionType: stream.RouteQuery,
+	}
+	data, _ := json.Marshal(msg)
+	if err := m.RemoteCli.SendMsg(dst, data); err != nil {
+		logs.Error("query routes err:%v, dst=%s", err, dst)
+	}
+}
+
+// GetDictionary 当前的路由字典 新握手的连接使用
+func (m *Manager) GetDictionary() *protocol.Dictionary {
+	m.routeLock.RLock()
+	defer m.routeLock.RUnlock()
+	return m.dictionary
+}
+
+func (m *Manager) updateServerRoutes(serverId string, routes []string) {
+	m.routeLock.Lock()
+	m.serverRoutes[serverId] = routes
+	m.routeLock.Unlock()
+	m.rebuildDictionary()
+}
+
+// rebuildDictionary 合并connector本地handler和各节点通告的路由 生成新的字典
+// 已经握手的连接继续使用旧字典 不受影响
+func (m *Manager) rebuildDictionary() {
+	routes := make([]string, 0)
+	if connectorConfig := game.Conf.GetConnector(m.ServerId); connectorConfig != nil {
+		for router := range m.ConnectorHandlers {
+			routes = append(routes, fmt.Sprintf("%s.%s", connectorConfig.ServerType, router))
+		}
+	}
+	m.routeLock.Lock()
+	defer m.routeLock.Unlock()
+	for _, v := range m.serverRoutes {
+		routes = append(routes, v...)
+	}
+	m.dictionary = protocol.NewDictionary(routes)
+	logs.Debug("route dictionary rebuilt, routes=%d", m.dictionary.Len())
+}
+
 // LoadBalanceStrategy 定义负载均衡策略类型
 type LoadBalanceStrategy int
 
@@ -609,11 +794,9 @@ type consistentHash struct {
 	mapping  map[uint32]string // 哈希值到服务器ID的映射
 }
 
-func (m *Manager) selectDst(serverType string) (string, error) {
-	serversConfigs, ok := game.Conf.ServersConf.TypeServer[serverType]
-	if !ok {
-		return "", errors.New("no server found")
-	}
+// selectDst 选择转发的节点 uid和ip用于一致性哈希和IP哈希策略
+func (m *Manager) selectDst(serverType string, uid string, ip string) (string, error) {
+	serversConfigs := m.Registry.Servers(serverType)
 
 	if len(serversConfigs) == 0 {
 		return "", errors.New("no available servers")
@@ -642,21 +825,20 @@ func (m *Manager) selectDst(serverType string) (string, error) {
 	case LeastConnection:
 		serverID = m.selectLeastConnectionServer(serversConfigs)
 	case ConsistentHash:
-		// 对于一致性哈希，我们需要一个键（通常是用户ID）
-		// 这里我们尝试从当前上下文获取用户ID，如果没有则回退到随机选择
-		uid := m.getCurrentUserID()
-		if uid != "" {
-			serverID = m.selectConsistentHashServer(serverType, uid, serversConfigs)
+		// 一致性哈希按用户ID选择 还没有登录时使用客户端IP
+		key := uid
+		if key == "" {
+			key = ip
+		}
+		if key != "" {
+			serverID = m.selectConsistentHashServer(serverType, key, serversConfigs)
 		} else {
 			serverID = m.selectRandomServer(serversConfigs)
 			logs.Debug("No user ID available for consistent hash, falling back to random selection")
 		}
 	case IPHash:
-		// 对于IP哈希，我们需要客户端IP
-		// 这里我们尝试从当前上下文获取客户端IP，如果没有则回退到随机选择
-		clientIP := m.getCurrentClientIP()
-		if clientIP != "" {
-			serverID = m.selectIPHashServer(serverType, clientIP, serversConfigs)
+		if ip != "" {
+			serverID = m.selectIPHashServer(serverType, ip, serversConfigs)
 		} else {
 			serverID = m.selectRandomServer(serversConfigs)
 			logs.Debug("No client IP available for IP hash, falling back to random selection")
@@ -698,19 +880,23 @@ func (m *Manager) selectRoundRobinServer(serverType string, servers []*game.Serv
 
 // selectWeightedRoundRobinServer 加权轮询选择服务器
 func (m *Manager) selectWeightedRoundRobinServer(servers []*game.ServersConfig) string {
-	// 这里我们假设ServerConfig中有一个Weight字段
-	// 如果没有，我们可以根据服务器的其他属性计算权重
+	// 按配置的权重随机选择 权重根据节点上报的负载调整 负载越高被选中的概率越低
+	m.lbState.mu.RLock()
+	weights := make([]float64, len(servers))
+	totalWeight := 0.0
+	for i, server := range servers {
+		weights[i] = registry.EffectiveWeight(server.Weight, m.lbState.serverLoads[server.ID])
+		totalWeight += weights[i]
+	}
+	m.lbState.mu.RUnlock()
 
-	// 简单实现：使用服务器配置中的某个属性作为权重
-	// 这里我们假设所有服务器权重相等，实际应用中可以根据需要修改
-	totalWeight := len(servers)
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	randomWeight := r.Intn(totalWeight)
+	randomWeight := r.Float64() * totalWeight
 
 	// 选择权重对应的服务器
-	currentWeight := 0
-	for _, server := range servers {
-		currentWeight++
+	currentWeight := 0.0
+	for i, server := range servers {
+		currentWeight += weights[i]
 		if currentWeight > randomWeight {
 			return server.ID
 		}
@@ -720,17 +906,21 @@ func (m *Manager) selectWeightedRoundRobinServer(servers []*game.ServersConfig)
 	return servers[0].ID
 }
 
-// selectLeastConnectionServer 选择连接数最少的服务器
+// selectLeastConnectionServer 选择负载最低的服务器 负载按权重折算 权重高的可以承担更多负载
 func (m *Manager) selectLeastConnectionServer(servers []*game.ServersConfig) string {
 	m.lbState.mu.RLock()
 	defer m.lbState.mu.RUnlock()
 
-	minLoad := -1
+	minLoad := -1.0
 	var selectedServer string
 
 	for _, server := range servers {
-		load, exists := m.lbState.serverLoads[server.ID]
-		if !exists || (minLoad == -1 || load < minLoad) {
+		weight := server.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		load := float64(m.lbState.serverLoads[server.ID]) / float64(weight)
+		if minLoad < 0 || load < minLoad {
 			minLoad = load
 			selectedServer = server.ID
 		}
@@ -812,64 +1002,6 @@ func (m *Manager) initConsistentHash(serverType string, servers []*game.ServersC
 	m.lbState.hashRing[serverType] = hashRing
 }
 
-// 上下文键，用于在请求上下文中存储用户ID和客户端IP
-var (
-	userIDContextKey   = struct{}{}
-	clientIPContextKey = struct{}{}
-	currentContext     context.Context // 当前请求上下文
-)
-
-// getCurrentUserID 获取当前上下文中的用户ID
-func (m *Manager) getCurrentUserID() string {
-	// 尝试从当前上下文中获取用户ID
-	if currentContext != nil {
-		if uid, ok := currentContext.Value(userIDContextKey).(string); ok && uid != "" {
-			return uid
-		}
-	}
-
-	// 如果无法从上下文中获取，尝试从当前处理的消息中获取
-	// 这需要在消息处理过程中设置一个线程本地变量或全局变量
-	// 在实际应用中，可能需要根据具体的消息处理流程来实现
-
-	// 这里我们可以尝试从当前正在处理的连接中获取用户ID
-	// 注意：这种方法只在处理特定连接的消息时有效
-	// 在其他情况下（如定时任务、系统事件等），可能无法获取用户ID
-
-	return ""
-}
-
-// getCurrentClientIP 获取当前上下文中的客户端IP
-func (m *Manager) getCurrentClientIP() string {
-	// 尝试从当前上下文中获取客户端IP
-	if currentContext != nil {
-		if ip, ok := currentContext.Value(clientIPContextKey).(string); ok && ip != "" {
-			return ip
-		}
-	}
-
-	// 如果无法从上下文中获取，尝试从当前处理的连接中获取
-	// 在实际应用中，WebSocket连接通常会记录客户端的IP地址
-
-	return ""
-}
-
-// SetRequestContext 设置当前请求上下文
-// 这个方法应该在处理每个请求之前调用，以便在负载均衡过程中使用上下文信息
-func (m *Manager) SetRequestContext(ctx context.Context) {
-	currentContext = ctx
-}
-
-// WithUserID 创建一个包含用户ID的上下文
-func WithUserID(ctx context.Context, userID string) context.Context {
-	return context.WithValue(ctx, userIDContextKey, userID)
-}
-
-// WithClientIP 创建一个包含客户端IP的上下文
-func WithClientIP(ctx context.Context, clientIP string) context.Context {
-	return context.WithValue(ctx, clientIPContextKey, clientIP)
-}
-
 // SetLoadBalanceStrategy 设置负载均衡策略
 func (m *Manager) SetLoadBalanceStrategy(strategy LoadBalanceStrategy) {
 	m.lbState.mu.Lock()
@@ -1037,17 +1169,48 @@ func (m *Manager) FindClientByUID(uid string) Connection {
 	return nil
 }
 
-func (m *Manager) Response(msg *stream.Msg) {
-	// 编码消息（只编码一次）
-	buf, err := protocol.MessageEncode(msg.Body)
+// encodeResponse 按连接的编码方式、压缩设置和路由字典编码消息 from是消息体当前的编码
+func (m *Manager) encodeResponse(body *protocol.Message, from protocol.Serializer, c Connection) ([]byte, error) {
+	session := c.GetSession()
+	message := *body
+	data, err := protocol.Transcode(body.Data, from, session.GetSerializer())
 	if err != nil {
-		logs.Error("Response MessageEncode err:%v", err)
-		return
+		return nil, err
+	}
+	message.Data = data
+	if session.IsCompress() {
+		compressConf := game.Conf.ServersConf.Compress
+		if err := message.Compress(compressConf.Threshold, compressConf.Level); err != nil {
+			return nil, err
+		}
 	}
-	res, err := protocol.Encode(protocol.Data, buf)
+	buf, err := protocol.MessageEncode(&message, c.GetDictionary())
 	if err != nil {
-		logs.Error("Response Encode err:%v", err)
-		return
+		return nil, err
+	}
+	return protocol.Encode(protocol.Data, buf)
+}
+
+func (m *Manager) Response(msg *stream.Msg) {
+	// 编码消息（相同编码方式、压缩设置和路由字典的连接只编码一次）
+	from := protocol.SerializerOrDefault(msg.Serializer)
+	var encodedLock sync.Mutex
+	encoded := make(map[string][]byte)
+	encodeFor := func(c Connection) []byte {
+		session := c.GetSession()
+		key := fmt.Sprintf("%s:%v:%p", session.GetSerializer().Name(), session.IsCompress(), c.GetDictionary())
+		encodedLock.Lock()
+		defer encodedLock.Unlock()
+		if buf, ok := encoded[key]; ok {
+			return buf
+		}
+		buf, err := m.encodeResponse(msg.Body, from, c)
+		if err != nil {
+			logs.Error("Response encode err:%v, key=%s", err, key)
+			buf = nil
+		}
+		encoded[key] = buf
+		return buf
 	}
 
 	if msg.Body.Type == protocol.Push {
@@ -1087,7 +1250,9 @@ func (m *Manager) Response(msg *stream.Msg) {
 					sendWg.Add(1)
 					go func(c Connection) {
 						defer sendWg.Done()
-						c.SendMessage(res)
+						if buf := encodeFor(c); buf != nil {
+							c.SendMessage(buf)
+						}
 					}(conn)
 				}
 			}
@@ -1103,7 +1268,9 @@ func (m *Manager) Response(msg *stream.Msg) {
 		bucket.RUnlock()
 
 		if ok {
-			connection.SendMessage(res)
+			if buf := encodeFor(connection); buf != nil {
+				connection.SendMessage(buf)
+			}
 		}
 	}
 }
@@ -1170,7 +1337,11 @@ func (m *Manager) setSessionData(msg stream.Msg) {
 		bucket.RUnlock()
 
 		if ok {
-			connection.GetSession().SetData(msg.Uid, msg.SessionData.SingleData)
+			session := connection.GetSession()
+			session.SetData(msg.Uid, msg.SessionData.SingleData)
+			for _, fn := range m.OnSessionChange {
+				fn(session)
+			}
 		}
 	}
 
@@ -1228,6 +1399,8 @@ func NewManager(maxConn int) *Manager {
 		RemoteReadChan: make(chan []byte, 2048),      // 增大缓冲区
 		RemotePushChan: make(chan *stream.Msg, 2048), // 增大缓冲区
 		data:           make(map[string]any),
+		serverRoutes:   make(map[string][]string),
+		Registry:       registry.New(),
 		maxConnections: maxConn,
 		connSemaphore:  make(chan struct{}, maxConn),
 		bucketMask:     bucketMask,
@@ -1253,6 +1426,9 @@ func NewManager(maxConn int) *Manager {
 		m.clientWorkers[i] = make(chan *MsgPack, 256)
 	}
 
+	// 节点上下线时重建一致性哈希环
+	m.Registry.OnChange(m.resetHashRing)
+
 	// 设置默认的CheckOriginHandler
 	m.CheckOriginHandler = func(r *http.Request) bool {
 		return true
@@ -1,11 +1,22 @@
 package node
 
 import (
+	"common/biz"
 	"common/logs"
+	"common/metrics"
+	"common/trace"
+	"context"
 	"encoding/json"
+	"fmt"
+	"framework/game"
+	"framework/msError"
+	"framework/protocol"
 	"framework/pusher"
+	"framework/registry"
 	"framework/remote"
 	"framework/stream"
+	"sync/atomic"
+	"time"
 )
 
 // App 就是nats的客户端 处理实际游戏逻辑的服务
@@ -14,6 +25,25 @@ type App struct {
 	readChan  chan []byte
 	writeChan chan *stream.Msg
 	handlers  LogicHandler
+	serverId  string
+	pool      *workerPool
+	//单个handler的超时时间 0表示不限制
+	handleTimeOut time.Duration
+	middlewares   []routeMiddleware
+	newClient     remote.ClientBuilder
+	serverConfig  *game.ServersConfig
+	done          chan struct{}
+	//game节点统计当前房间数 随心跳上报负载
+	roomCounter func() int
+	draining    atomic.Bool
+	drainHooks  []DrainHook
+	startHooks  []func(session *remote.Session)
+	//除了节点自己和registry.Subject之外额外订阅的广播地址
+	subjects []string
+	//其他节点的心跳 停机时从中选择迁移的目标
+	servers *registry.Registry
+	//查询用户所在的connector 踢人时使用
+	onlineLookup pusher.OnlineLookup
 }
 
 func Default() *App {
@@ -21,21 +51,70 @@ func Default() *App {
 		readChan:  make(chan []byte, 1024),
 		writeChan: make(chan *stream.Msg, 1024),
 		handlers:  make(LogicHandler),
+		newClient: remote.NatsClientBuilder,
+		done:      make(chan struct{}),
+		servers:   registry.New(),
 	}
 }
 
 func (a *App) Run(serverId string) error {
-	a.remoteCli = remote.NewNatsClient(serverId, a.readChan)
+	a.serverId = serverId
+	maxRunRoutineNum := 0
+	a.serverConfig = game.Conf.GetServersConfig(serverId)
+	if serverConfig := a.serverConfig; serverConfig != nil {
+		maxRunRoutineNum = serverConfig.MaxRunRoutineNum
+		a.handleTimeOut = time.Duration(serverConfig.HandleTimeOut) * time.Second
+	}
+	a.pool = newWorkerPool(maxRunRoutineNum)
+	a.applyMiddlewares()
+	a.remoteCli = a.newClient(serverId, a.readChan)
 	err := a.remoteCli.Run()
 	if err != nil {
 		return err
 	}
 	pusher.NewPusher(a.remoteCli)
+	pusher.GetPusher().SetDiscovery(a.onlineLookup, a.Connectors)
+	//恢复状态完成后再对外通告 避免恢复前收到请求
+	session := a.NewSession()
+	for _, hook := range a.startHooks {
+		hook(session)
+	}
+	//订阅广播地址 connector启动时会在这里查询路由和存活的节点
+	if err := a.remoteCli.Subscribe(registry.Subject); err != nil {
+		return err
+	}
+	for _, subject := range a.subjects {
+		if err := a.remoteCli.Subscribe(subject); err != nil {
+			return err
+		}
+	}
 	go a.readChanMsg(serverId)
 	go a.writeChanMsg()
+	//通告所有connector 当前节点上线和注册的路由
+	a.announceRoutes(serverId, registry.Subject)
+	go a.heartbeat()
 	return nil
 }
 
+// announceRoutes 将注册的handler以客户端路由的形式(serverType.handler.method)发送给connector
+func (a *App) announceRoutes(serverId string, dst string) {
+	serverConfig := a.serverConfig
+	if serverConfig == nil {
+		logs.Warn("app announceRoutes no server config found, serverId=%s", serverId)
+		return
+	}
+	routes := make([]string, 0, len(a.handlers))
+	for router := range a.handlers {
+		routes = append(routes, fmt.Sprintf("%s.%s", serverConfig.ServerType, router))
+	}
+	a.writeChan <- &stream.Msg{
+		Src:         serverId,
+		Dst:         dst,
+		SessionType: stream.RouteAnnounce,
+		Routes:      routes,
+	}
+}
+
 func (a *App) readChanMsg(serverId string) {
 	//收到的是 其他nas client发送的消息
 	for {
@@ -43,59 +122,285 @@ func (a *App) readChanMsg(serverId string) {
 		case msg := <-a.readChan:
 			var remoteMsg stream.Msg
 			json.Unmarshal(msg, &remoteMsg)
-			logs.Warn("app readChanMsg:%v", string(remoteMsg.Body.Data))
+			if remoteMsg.SessionType == stream.RouteQuery {
+				a.sendHeartbeat(remoteMsg.Src)
+				a.announceRoutes(serverId, remoteMsg.Src)
+				continue
+			}
+			if remoteMsg.SessionType == stream.Heartbeat || remoteMsg.SessionType == stream.ServerLeave {
+				a.serverHeartbeat(&remoteMsg)
+				continue
+			}
+			if remoteMsg.SessionType != stream.Normal {
+				//其他节点的路由通告 节点不需要处理
+				continue
+			}
 			session := remote.NewSession(a.remoteCli, &remoteMsg)
 			session.SetServerId(serverId)
 			session.SetData(remoteMsg.SessionData)
+			session.Logger().Debug("app readChanMsg size=%d", len(remoteMsg.Body.Data))
 			//根据路由消息 发送给对应的handler进行处理
 			router := remoteMsg.Router
-			if handlerFunc := a.handlers[router]; handlerFunc != nil {
-				go func() {
-					result := handlerFunc(session, remoteMsg.Body.Data)
-					message := remoteMsg.Body
-					var body []byte
-					if result == nil {
-						return
-					}
-					body, _ = json.Marshal(result)
-					message.Data = body
-					//得到结果了 发送给connector
-					responseMsg := &stream.Msg{
-						Src:  remoteMsg.Dst,
-						Dst:  remoteMsg.Src,
-						Body: message,
-						Uid:  remoteMsg.Uid,
-						Cid:  remoteMsg.Cid,
-					}
-					a.writeChan <- responseMsg
-				}()
+			handler := a.handlers[router]
+			if handler == nil {
+				if remoteMsg.Reply != "" {
+					logs.Error("app rpc handler not found, router=%s", router)
+					a.responseError(&remoteMsg, session.GetSerializer(), msError.RPCHandlerNotFound)
+				}
+				continue
+			}
+			//只统计注册过的路由 避免客户端随意的路由产生大量指标
+			metrics.MessagesIn.WithLabelValues(router).Inc()
+			task := func() { a.handle(session, &remoteMsg, handler.Func) }
+			var ok bool
+			if key := handler.dispatchKey(session); key != "" {
+				ok = a.pool.submitOrdered(key, task)
+			} else {
+				ok = a.pool.submit(task)
+			}
+			if !ok {
+				stats := a.pool.stats()
+				logs.Warn("app worker pool is full, router=%s, uid=%s, queued=%d, rejected=%d",
+					router, remoteMsg.Uid, stats.Queued, stats.Rejected)
+				a.responseError(&remoteMsg, session.GetSerializer(), msError.ServerBusy)
 			}
 		}
 	}
 
 }
 
+// handle 在worker中执行handler 超过handleTimeOut还没有结果时先返回超时错误 之后的结果丢弃
+func (a *App) handle(session *remote.Session, remoteMsg *stream.Msg, handlerFunc HandlerFunc) {
+	//handler统一按json解析请求 其他编码先转成json
+	serializer := session.GetSerializer()
+	data, err := protocol.Transcode(remoteMsg.Body.Data, serializer, protocol.DefaultSerializer())
+	if err != nil {
+		logs.Error("app transcode request err:%v, serializer=%s", err, serializer.Name())
+		//请求数据解析不了 也要回复 避免客户端和rpc调用方一直等到超时
+		a.responseError(remoteMsg, serializer, biz.RequestDataError)
+		return
+	}
+	//挂在上游的span下 转发 rpc和回复都带上当前span 下游的span挂在这里
+	span := trace.Start(a.serverId+" "+remoteMsg.Router, remoteMsg.TraceId, remoteMsg.SpanId)
+	span.SetAttr("uid", remoteMsg.Uid)
+	defer span.End()
+	remoteMsg.TraceId = span.TraceId()
+	remoteMsg.SpanId = span.SpanId()
+	var done atomic.Bool
+	if a.handleTimeOut > 0 {
+		//超时后取消session的context handler中使用它的数据库等操作会提前返回
+		ctx, cancel := context.WithTimeout(context.Background(), a.handleTimeOut)
+		defer cancel()
+		session.SetContext(ctx)
+		timer := time.AfterFunc(a.handleTimeOut, func() {
+			if done.CompareAndSwap(false, true) {
+				a.pool.timedOut.Add(1)
+				a.pool.overrun.Add(1)
+				logs.Error("app handler timeout, router=%s, uid=%s, timeout=%v", remoteMsg.Router, remoteMsg.Uid, a.handleTimeOut)
+				span.SetError(msError.HandleTimeout)
+				a.responseError(remoteMsg, serializer, msError.HandleTimeout)
+			}
+		})
+		defer timer.Stop()
+	}
+	result := handlerFunc(session, data)
+	if !done.CompareAndSwap(false, true) {
+		a.pool.overrun.Add(-1)
+		logs.Warn("app handler finished after timeout, result dropped, router=%s, uid=%s", remoteMsg.Router, remoteMsg.Uid)
+		return
+	}
+	if result == nil {
+		if remoteMsg.Reply != "" {
+			//rpc调用方在等待回复 没有结果也需要回复
+			a.writeChan <- &stream.Msg{
+				Src:     remoteMsg.Dst,
+				Dst:     remoteMsg.Src,
+				Uid:     remoteMsg.Uid,
+				Cid:     remoteMsg.Cid,
+				Reply:   remoteMsg.Reply,
+				TraceId: remoteMsg.TraceId,
+				SpanId:  remoteMsg.SpanId,
+			}
+		}
+		return
+	}
+	a.response(remoteMsg, serializer, result)
+}
+
+// response 将handler的结果发送给connector或者rpc调用方
+func (a *App) response(remoteMsg *stream.Msg, serializer protocol.Serializer, result any) {
+	message := *remoteMsg.Body
+	body, err := serializer.Marshal(result)
+	if err != nil {
+		logs.Error("app marshal response err:%v, serializer=%s", err, serializer.Name())
+		return
+	}
+	message.Data = body
+	//得到结果了 发送给connector
+	responseMsg := &stream.Msg{
+		Src:        remoteMsg.Dst,
+		Dst:        remoteMsg.Src,
+		Body:       &message,
+		Uid:        remoteMsg.Uid,
+		Cid:        remoteMsg.Cid,
+		Serializer: serializer.Name(),
+		Reply:      remoteMsg.Reply,
+		TraceId:    remoteMsg.TraceId,
+		SpanId:     remoteMsg.SpanId,
+	}
+	a.writeChan <- responseMsg
+}
+
+// responseError rpc调用返回错误码 客户端的request返回错误结果 notify不需要回复
+func (a *App) responseError(remoteMsg *stream.Msg, serializer protocol.Serializer, err *msError.Error) {
+	if remoteMsg.Reply != "" {
+		a.writeChan <- &stream.Msg{
+			Src:     remoteMsg.Dst,
+			Dst:     remoteMsg.Src,
+			Uid:     remoteMsg.Uid,
+			Cid:     remoteMsg.Cid,
+			Reply:   remoteMsg.Reply,
+			Code:    err.Code,
+			ErrMsg:  err.Error(),
+			TraceId: remoteMsg.TraceId,
+			SpanId:  remoteMsg.SpanId,
+		}
+		return
+	}
+	if remoteMsg.Body == nil || remoteMsg.Body.Type != protocol.Request {
+		return
+	}
+	a.response(remoteMsg, serializer, msError.Result{Code: err.Code})
+}
+
+// PoolStats handler协程池的状态 用于监控
+func (a *App) PoolStats() PoolStats {
+	if a.pool == nil {
+		return PoolStats{}
+	}
+	return a.pool.stats()
+}
+
+// RegisterPoolGauges 注册协程池状态的指标 subsystem区分单进程模式下的不同服务
+// 协程池在Run中创建 指标在节点启动时注册 避免抓取时和创建协程池竞争
+func (a *App) RegisterPoolGauges(subsystem string) {
+	a.OnStart(func(*remote.Session) {
+		a.registerPoolGauges(subsystem)
+	})
+}
+
+func (a *App) registerPoolGauges(subsystem string) {
+	metrics.RegisterGaugeFunc(subsystem, "pool_workers", "handler协程池的worker数量", func() float64 {
+		return float64(a.PoolStats().Workers)
+	})
+	metrics.RegisterGaugeFunc(subsystem, "pool_queued", "排队等待处理的消息数", func() float64 {
+		return float64(a.PoolStats().Queued)
+	})
+	metrics.RegisterGaugeFunc(subsystem, "pool_running", "正在执行的handler数", func() float64 {
+		return float64(a.PoolStats().Running)
+	})
+	metrics.RegisterGaugeFunc(subsystem, "pool_rejected", "队列满被拒绝的消息数", func() float64 {
+		return float64(a.PoolStats().Rejected)
+	})
+	metrics.RegisterGaugeFunc(subsystem, "pool_timed_out", "处理超时的消息数", func() float64 {
+		return float64(a.PoolStats().TimedOut)
+	})
+	metrics.RegisterGaugeFunc(subsystem, "pool_overrun", "已经超时但handler还在执行的消息数", func() float64 {
+		return float64(a.PoolStats().Overrun)
+	})
+}
+
 func (a *App) writeChanMsg() {
 	for {
 		select {
 		case msg, ok := <-a.writeChan:
 			if ok {
 				marshal, _ := json.Marshal(msg)
-				err := a.remoteCli.SendMsg(msg.Dst, marshal)
+				dst := msg.Dst
+				if msg.Reply != "" {
+					//rpc调用的结果直接回复给调用方
+					dst = msg.Reply
+				}
+				err := a.remoteCli.SendMsg(dst, marshal)
 				if err != nil {
 					logs.Error("app remote send stream err:%v", err)
+				} else if msg.SessionType == stream.Normal {
+					metrics.MessagesOut.WithLabelValues(msgRoute(msg)).Inc()
 				}
 			}
 		}
 	}
 }
 
+// msgRoute 统计时使用的路由 响应使用请求的路由 rpc没有结果的回复为空
+func msgRoute(msg *stream.Msg) string {
+	if msg.Router != "" {
+		return msg.Router
+	}
+	if msg.Body != nil {
+		return msg.Body.Route
+	}
+	return ""
+}
+
+// Call 节点间同步调用 返回dst节点上route对应handler结果的json数据
+func (a *App) Call(ctx context.Context, dst string, route string, req any) ([]byte, *msError.Error) {
+	msg := &stream.Msg{
+		Src: a.serverId,
+		Dst: dst,
+	}
+	return remote.Call(ctx, a.remoteCli, msg, route, req)
+}
+
 func (a *App) Close() {
 	if a.remoteCli != nil {
+		close(a.done)
+		a.leave()
 		a.remoteCli.Close()
 	}
 }
 
+// SetClientBuilder 替换节点间通信的客户端 比如单进程模式下使用remote.LocalBus 需要在Run之前调用
+func (a *App) SetClientBuilder(builder remote.ClientBuilder) {
+	a.newClient = builder
+}
+
+// NewSession 节点主动推送时使用的session 比如停机时解散房间 没有对应的客户端请求
+func (a *App) NewSession() *remote.Session {
+	session := remote.NewSession(a.remoteCli, &stream.Msg{
+		Src:  a.serverId,
+		Dst:  a.serverId,
+		Body: &protocol.Message{Type: protocol.Push},
+	})
+	session.SetServerId(a.serverId)
+	return session
+}
+
+// SetRoomCounter 设置统计房间数的方法 房间数作为负载的一部分上报给connector
+func (a *App) SetRoomCounter(counter func() int) {
+	a.roomCounter = counter
+}
+
+// SetOnlineLookup 设置查询用户所在connector的方式 需要在Run之前调用
+func (a *App) SetOnlineLookup(lookup pusher.OnlineLookup) {
+	a.onlineLookup = lookup
+}
+
+// OnStart 注册节点启动时的处理 在连接建立之后 通告路由之前调用 比如从快照恢复房间
+func (a *App) OnStart(hook func(session *remote.Session)) {
+	a.startHooks = append(a.startHooks, hook)
+}
+
+// Done 节点关闭时关闭 OnStart中启动的定时任务用它退出
+func (a *App) Done() <-chan struct{} {
+	return a.done
+}
+
+// Subscribe 订阅广播地址 发到该地址的消息和发给节点的消息一样按路由处理 需要在Run之前调用
+func (a *App) Subscribe(subject string) {
+	a.subjects = append(a.subjects, subject)
+}
+
 func (a *App) RegisterHandler(handler LogicHandler) {
 	a.handlers = handler
 }
@@ -0,0 +1,200 @@
+package node
+
+import (
+	"common/biz"
+	"common/config"
+	"common/logs"
+	"context"
+	"encoding/json"
+	"framework/game"
+	"framework/msError"
+	"framework/protocol"
+	"framework/pusher"
+	"framework/registry"
+	"framework/remote"
+	"framework/stream"
+	"testing"
+	"time"
+)
+
+func TestPushThroughNodeSession(t *testing.T) {
+	config.Conf = new(config.Config)
+	logs.InitLog("node")
+	bus := remote.NewLocalBus()
+	connectorChan := make(chan []byte, 8)
+	connector := bus.Builder()("connector-001", connectorChan)
+	_ = connector.Run()
+	a := &App{serverId: "game-001", remoteCli: bus.Builder()("game-001", make(chan []byte, 8))}
+	_ = a.remoteCli.Run()
+	pusher.NewPusher(a.remoteCli)
+	//停机解散房间和恢复房间时 没有客户端请求 使用节点的session推送
+	session := a.NewSession()
+	users := []stream.PushUser{{Uid: "1001", ConnectorId: "connector-001"}}
+	pusher.GetPusher().Push(session.GetMsg(), users, map[string]any{"type": 1}, "roomPush")
+	select {
+	case data := <-connectorChan:
+		var msg stream.Msg
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("unmarshal err:%v", err)
+		}
+		if msg.Body == nil || msg.Body.Type != protocol.Push || msg.Body.Route != "roomPush" {
+			t.Fatalf("unexpected push %+v", msg.Body)
+		}
+		if len(msg.PushUser) != 1 || msg.PushUser[0] != "1001" {
+			t.Fatalf("unexpected push users %v", msg.PushUser)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("push not received")
+	}
+}
+
+func TestHandleTranscodeErrorResponds(t *testing.T) {
+	config.Conf = new(config.Config)
+	logs.InitLog("node")
+	a := &App{serverId: "hall-001", writeChan: make(chan *stream.Msg, 1)}
+	remoteMsg := &stream.Msg{
+		Src:        "connector-001",
+		Dst:        "hall-001",
+		Router:     "userHandler.updateUserAddress",
+		Uid:        "1001",
+		Serializer: protocol.MsgpackSerializerName,
+		//0xc1在msgpack中没有使用 解析一定失败
+		Body: &protocol.Message{Type: protocol.Request, ID: 1, Data: []byte{0xc1}},
+	}
+	called := false
+	a.handle(remote.NewSession(nil, remoteMsg), remoteMsg, func(session *remote.Session, msg []byte) any {
+		called = true
+		return nil
+	})
+	if called {
+		t.Fatalf("handler should not be called with bad request data")
+	}
+	select {
+	case msg := <-a.writeChan:
+		var res msError.Result
+		if err := protocol.SerializerOrDefault(msg.Serializer).Unmarshal(msg.Body.Data, &res); err != nil {
+			t.Fatalf("unmarshal err:%v", err)
+		}
+		if res.Code != biz.RequestDataError.Code || msg.Dst != "connector-001" || msg.Body.ID != 1 {
+			t.Fatalf("unexpected response %+v code=%d", msg, res.Code)
+		}
+	default:
+		t.Fatalf("no response for bad request data")
+	}
+}
+
+func TestHandleTimeoutCancelsContext(t *testing.T) {
+	config.Conf = new(config.Config)
+	logs.InitLog("node")
+	a := &App{
+		serverId:      "hall-001",
+		writeChan:     make(chan *stream.Msg, 1),
+		pool:          newWorkerPool(1),
+		handleTimeOut: 20 * time.Millisecond,
+	}
+	remoteMsg := &stream.Msg{
+		Src:    "connector-001",
+		Dst:    "hall-001",
+		Router: "userHandler.updateUserAddress",
+		Uid:    "1001",
+		Body:   &protocol.Message{Type: protocol.Request, ID: 1, Data: []byte("{}")},
+	}
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		a.handle(remote.NewSession(nil, remoteMsg), remoteMsg, func(session *remote.Session, msg []byte) any {
+			<-session.Context().Done()
+			<-release
+			return nil
+		})
+	}()
+	select {
+	case msg := <-a.writeChan:
+		var res msError.Result
+		if err := json.Unmarshal(msg.Body.Data, &res); err != nil || res.Code != msError.HandleTimeout.Code {
+			t.Fatalf("unexpected timeout response code=%d err:%v", res.Code, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no timeout response")
+	}
+	if stats := a.PoolStats(); stats.TimedOut != 1 || stats.Overrun != 1 {
+		t.Fatalf("unexpected stats while handler still running %+v", stats)
+	}
+	close(release)
+	<-finished
+	if stats := a.PoolStats(); stats.TimedOut != 1 || stats.Overrun != 0 {
+		t.Fatalf("unexpected stats after handler finished %+v", stats)
+	}
+}
+
+func TestAvailableServers(t *testing.T) {
+	a := Default()
+	a.serverId = "game-001"
+	a.serverConfig = &game.ServersConfig{ID: "game-001", ServerType: "game"}
+	for _, conf := range []*game.ServersConfig{
+		{ID: "game-001", ServerType: "game"},
+		{ID: "game-002", ServerType: "game"},
+		{ID: "game-003", ServerType: "game"},
+		{ID: "hall-001", ServerType: "hall"},
+	} {
+		a.serverHeartbeat(&stream.Msg{Src: conf.ID, SessionType: stream.Heartbeat, Server: conf})
+	}
+	a.serverHeartbeat(&stream.Msg{Src: "game-003", SessionType: stream.Heartbeat, Server: &game.ServersConfig{ID: "game-003", ServerType: "game"}, Draining: true})
+	if got := a.AvailableServers(); len(got) != 1 || got[0] != "game-002" {
+		t.Fatalf("unexpected available servers %v", got)
+	}
+	a.serverHeartbeat(&stream.Msg{Src: "game-002", SessionType: stream.ServerLeave})
+	if got := a.AvailableServers(); len(got) != 0 {
+		t.Fatalf("left server still available %v", got)
+	}
+}
+
+func TestKickUsesOnlineRegistry(t *testing.T) {
+	config.Conf = new(config.Config)
+	logs.InitLog("node")
+	bus := remote.NewLocalBus()
+	connectorChans := make(map[string]chan []byte)
+	for _, id := range []string{"connector-001", "connector-002"} {
+		connectorChans[id] = make(chan []byte, 8)
+		_ = bus.Builder()(id, connectorChans[id]).Run()
+	}
+	a := Default()
+	a.serverId = "hall-001"
+	a.remoteCli = bus.Builder()("hall-001", make(chan []byte, 8))
+	_ = a.remoteCli.Run()
+	a.serverHeartbeat(&stream.Msg{Src: "connector-001", SessionType: stream.Heartbeat,
+		Server: &game.ServersConfig{ID: "connector-001", ServerType: registry.ConnectorType}})
+	online := map[string]string{"1001": "connector-002"}
+	a.SetOnlineLookup(func(ctx context.Context, uid string) (string, error) {
+		return online[uid], nil
+	})
+	pusher.NewPusher(a.remoteCli)
+	pusher.GetPusher().SetDiscovery(a.onlineLookup, a.Connectors)
+
+	expectKick := func(connectorId string, uid string) {
+		select {
+		case data := <-connectorChans[connectorId]:
+			var msg stream.Msg
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.SessionType != stream.Kick || msg.Uid != uid || msg.KickReason != protocol.KickBlocked {
+				t.Fatalf("unexpected kick %+v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("kick %s not received on %s", uid, connectorId)
+		}
+	}
+	//在线注册表中有记录时只发给用户所在的connector
+	pusher.Kick("1001", protocol.KickBlocked)
+	expectKick("connector-002", "1001")
+	//查不到时发给心跳发现的connector
+	pusher.Kick("1002", protocol.KickBlocked)
+	expectKick("connector-001", "1002")
+	select {
+	case <-connectorChans["connector-002"]:
+		t.Fatalf("kick sent to connector without the user")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,6 +1,47 @@
 package node
 
-import "framework/remote"
+import (
+	"fmt"
+	"framework/remote"
+)
 
 type HandlerFunc func(session *remote.Session, msg []byte) any
-type LogicHandler map[string]HandlerFunc
+
+// DispatchMode handler的调度方式
+type DispatchMode int
+
+const (
+	DispatchConcurrent DispatchMode = iota // 每条消息并发处理 默认方式
+	DispatchByUid                          // 同一个用户的消息按顺序处理
+	DispatchByRoom                         // 同一个房间的消息按顺序处理 session中没有roomId时按用户处理
+)
+
+type Handler struct {
+	Func     HandlerFunc
+	Dispatch DispatchMode
+}
+
+type LogicHandler map[string]*Handler
+
+// Register 注册路由 dispatch不传时并发处理
+func (h LogicHandler) Register(router string, fn HandlerFunc, dispatch ...DispatchMode) {
+	handler := &Handler{Func: fn}
+	if len(dispatch) > 0 {
+		handler.Dispatch = dispatch[0]
+	}
+	h[router] = handler
+}
+
+// dispatchKey 顺序处理的key 返回空表示并发处理
+func (h *Handler) dispatchKey(session *remote.Session) string {
+	switch h.Dispatch {
+	case DispatchByRoom:
+		if roomId, ok := session.Get("roomId"); ok && roomId != nil && roomId != "" {
+			return fmt.Sprintf("room:%v", roomId)
+		}
+		return "uid:" + session.GetUid()
+	case DispatchByUid:
+		return "uid:" + session.GetUid()
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package node
+
+import (
+	"common/logs"
+	"encoding/json"
+	"framework/registry"
+	"framework/remote"
+	"framework/stream"
+	"runtime"
+	"time"
+)
+
+// defaultDrainTimeOut 停机时默认等待的时间
+const defaultDrainTimeOut = 5 * time.Minute
+
+// heartbeat 定时广播心跳 connector据此维护存活的节点 超时没有心跳的节点不再转发请求
+func (a *App) heartbeat() {
+	if a.serverConfig == nil {
+		logs.Warn("app heartbeat no server config found, serverId=%s", a.serverId)
+		return
+	}
+	a.sendHeartbeat(registry.Subject)
+	ticker := time.NewTicker(registry.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.sendHeartbeat(registry.Subject)
+			a.servers.Sweep(time.Now())
+		}
+	}
+}
+
+func (a *App) sendHeartbeat(dst string) {
+	if a.serverConfig == nil {
+		return
+	}
+	a.writeChan <- &stream.Msg{
+		Src:         a.serverId,
+		Dst:         dst,
+		SessionType: stream.Heartbeat,
+		Server:      a.serverConfig,
+		Load:        a.load(),
+		Draining:    a.draining.Load(),
+	}
+}
+
+// serverHeartbeat 记录其他节点的心跳和下线 自己的心跳忽略
+func (a *App) serverHeartbeat(msg *stream.Msg) {
+	if msg.Src == a.serverId {
+		return
+	}
+	if msg.SessionType == stream.ServerLeave {
+		a.servers.Remove(msg.Src)
+		return
+	}
+	a.servers.Update(msg.Server, time.Now())
+	a.servers.SetDraining(msg.Src, msg.Draining)
+}
+
+// AvailableServers 和当前节点同类型 存活并且没有在排空的其他节点 比如停机时迁移房间的目标
+func (a *App) AvailableServers() []string {
+	if a.serverConfig == nil {
+		return nil
+	}
+	ids := make([]string, 0)
+	for _, v := range a.servers.Servers(a.serverConfig.ServerType) {
+		if v.ID != a.serverId && a.servers.Available(v.ID) {
+			ids = append(ids, v.ID)
+		}
+	}
+	return ids
+}
+
+// Connectors 通过心跳发现的存活的connector
+func (a *App) Connectors() []string {
+	ids := make([]string, 0)
+	for _, v := range a.servers.Servers(registry.ConnectorType) {
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
+
+// Drain 进入排空状态 立即通知connector不再转发新的请求到当前节点
+func (a *App) Drain() {
+	if a.draining.Swap(true) {
+		return
+	}
+	logs.Info("app start draining, serverId=%s", a.serverId)
+	a.sendHeartbeat(registry.Subject)
+}
+
+func (a *App) IsDraining() bool {
+	return a.draining.Load()
+}
+
+// DrainHook 停机排空时调用 比如等待牌局结束后解散房间 需要在timeout内返回
+type DrainHook func(session *remote.Session, timeout time.Duration)
+
+// OnDrain 注册停机排空时的处理 Shutdown时按注册顺序调用
+func (a *App) OnDrain(hook DrainHook) {
+	a.drainHooks = append(a.drainHooks, hook)
+}
+
+// Shutdown 优雅停机 先排空 等待注册的处理完成后再关闭节点
+func (a *App) Shutdown() {
+	a.Drain()
+	timeout := defaultDrainTimeOut
+	if a.serverConfig != nil && a.serverConfig.DrainTimeOut > 0 {
+		timeout = time.Duration(a.serverConfig.DrainTimeOut) * time.Second
+	}
+	session := a.NewSession()
+	for _, hook := range a.drainHooks {
+		hook(session, timeout)
+	}
+	a.Close()
+}
+
+// load 当前节点的负载 connector的LeastConnection和WeightedRoundRobin策略使用
+func (a *App) load() *registry.Load {
+	stats := a.pool.stats()
+	load := &registry.Load{
+		Running:    int(stats.Running),
+		Queued:     stats.Queued,
+		Workers:    stats.Workers,
+		Goroutines: runtime.NumGoroutine(),
+	}
+	if a.roomCounter != nil {
+		load.Rooms = a.roomCounter()
+	}
+	return load
+}
+
+// leave 通知connector当前节点下线 直接发送 不经过writeChan 避免关闭时丢失
+func (a *App) leave() {
+	msg := &stream.Msg{
+		Src:         a.serverId,
+		Dst:         registry.Subject,
+		SessionType: stream.ServerLeave,
+	}
+	data, _ := json.Marshal(msg)
+	if err := a.remoteCli.SendMsg(registry.Subject, data); err != nil {
+		logs.Error("app send leave err:%v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package node
+
+import (
+	"framework/limiter"
+	"framework/msError"
+	"framework/remote"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Middleware 包装handler 可以在handler执行前后做统一处理 router为handler注册的路由
+type Middleware func(router string, next HandlerFunc) HandlerFunc
+
+type routeMiddleware struct {
+	prefix     string
+	middleware Middleware
+}
+
+// Use 对所有路由生效的中间件 先注册的在最外层
+func (a *App) Use(middleware ...Middleware) {
+	a.UseRoute("", middleware...)
+}
+
+// UseRoute 只对指定前缀的路由生效 比如 "gameHandler." 需要在Run之前注册
+func (a *App) UseRoute(prefix string, middleware ...Middleware) {
+	for _, m := range middleware {
+		a.middlewares = append(a.middlewares, routeMiddleware{prefix: prefix, middleware: m})
+	}
+}
+
+// applyMiddlewares 为每个路由生成中间件链
+func (a *App) applyMiddlewares() {
+	if len(a.middlewares) == 0 {
+		return
+	}
+	handlers := make(LogicHandler, len(a.handlers))
+	for router, handler := range a.handlers {
+		fn := handler.Func
+		for i := len(a.middlewares) - 1; i >= 0; i-- {
+			if strings.HasPrefix(router, a.middlewares[i].prefix) {
+				fn = a.middlewares[i].middleware(router, fn)
+			}
+		}
+		handlers[router] = &Handler{Func: fn, Dispatch: handler.Dispatch}
+	}
+	a.handlers = handlers
+}
+
+// Recovery handler panic时返回服务器错误 避免整个进程退出
+func Recovery() Middleware {
+	return func(router string, next HandlerFunc) HandlerFunc {
+		return func(session *remote.Session, msg []byte) (result any) {
+			defer func() {
+				if err := recover(); err != nil {
+					session.Logger().Error("handler panic err:%v\n%s", err, debug.Stack())
+					result = msError.Result{Code: msError.ServerError.Code}
+				}
+			}()
+			return next(session, msg)
+		}
+	}
+}
+
+// Logger 记录请求的路由、用户和耗时
+func Logger() Middleware {
+	return func(router string, next HandlerFunc) HandlerFunc {
+		return func(session *remote.Session, msg []byte) any {
+			start := time.Now()
+			result := next(session, msg)
+			session.Logger().Info("handler cost=%v", time.Since(start))
+			return result
+		}
+	}
+}
+
+// Auth 没有登录的用户直接返回fail 节点之间的rpc调用(App.Call)没有用户 不做校验
+func Auth(fail any) Middleware {
+	return func(router string, next HandlerFunc) HandlerFunc {
+		return func(session *remote.Session, msg []byte) any {
+			if session.GetUid() == "" && session.GetMsg().Reply == "" {
+				session.Logger().Warn("handler auth fail")
+				return fail
+			}
+			return next(session, msg)
+		}
+	}
+}
+
+// RateLimit 按用户限流 每秒r个请求 允许突发burst个 超出返回fail
+func RateLimit(r float64, burst int, fail any) Middleware {
+	l := limiter.NewKeyLimiter(r, burst)
+	return func(router string, next HandlerFunc) HandlerFunc {
+		return func(session *remote.Session, msg []byte) any {
+			if !l.Allow(session.GetUid()) {
+				session.Logger().Warn("handler rate limited")
+				return fail
+			}
+			return next(session, msg)
+		}
+	}
+}
+
+// Metrics handler执行完后回调observe 用于统计请求数和耗时
+func Metrics(observe func(router string, cost time.Duration)) Middleware {
+	return func(router string, next HandlerFunc) HandlerFunc {
+		return func(session *remote.Session, msg []byte) any {
+			start := time.Now()
+			result := next(session, msg)
+			observe(router, time.Since(start))
+			return result
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package node
+
+import (
+	"framework/remote"
+	"framework/stream"
+	"testing"
+)
+
+func TestApplyMiddlewares(t *testing.T) {
+	a := Default()
+	var order []string
+	mark := func(name string) Middleware {
+		return func(router string, next HandlerFunc) HandlerFunc {
+			return func(session *remote.Session, msg []byte) any {
+				order = append(order, name)
+				return next(session, msg)
+			}
+		}
+	}
+	a.handlers.Register("gameHandler.gameMessageNotify", func(session *remote.Session, msg []byte) any { return nil })
+	a.handlers.Register("unionHandler.joinRoom", func(session *remote.Session, msg []byte) any { return nil })
+	a.Use(mark("all"))
+	a.UseRoute("gameHandler.", mark("game"))
+	a.applyMiddlewares()
+	session := remote.NewSession(nil, &stream.Msg{Uid: "1"})
+	a.handlers["gameHandler.gameMessageNotify"].Func(session, nil)
+	a.handlers["unionHandler.joinRoom"].Func(session, nil)
+	if len(order) != 3 || order[0] != "all" || order[1] != "game" || order[2] != "all" {
+		t.Fatalf("unexpected middleware order %v", order)
+	}
+}
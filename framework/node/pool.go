@@ -0,0 +1,120 @@
+package node
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// defaultMaxRunRoutineNum 配置中没有设置maxRunRoutineNum时使用
+const defaultMaxRunRoutineNum = 1024
+
+// PoolStats handler协程池的运行状态
+type PoolStats struct {
+	Workers  int   //worker数量
+	Queued   int   //排队等待处理的消息数
+	Running  int64 //正在执行的handler数
+	Rejected int64 //队列满被拒绝的消息数
+	TimedOut int64 //处理超时的消息数
+	Overrun  int64 //已经超时但handler还在执行的消息数 一直占用worker
+}
+
+// workerPool 固定数量的worker处理handler 队列满时直接拒绝 避免消息过多时无限制的创建协程
+type workerPool struct {
+	tasks    chan func()
+	workers  int
+	running  atomic.Int64
+	rejected atomic.Int64
+	timedOut atomic.Int64
+	overrun  atomic.Int64
+	//顺序处理的消息 同一个key同时只有一个worker在处理
+	orderedLock sync.Mutex
+	ordered     map[string][]func()
+}
+
+func newWorkerPool(workers int) *workerPool {
+	if workers <= 0 {
+		workers = defaultMaxRunRoutineNum
+	}
+	p := &workerPool{
+		tasks:   make(chan func(), workers),
+		workers: workers,
+		ordered: make(map[string][]func()),
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	for task := range p.tasks {
+		p.running.Add(1)
+		task()
+		p.running.Add(-1)
+	}
+}
+
+// submit 提交任务 队列已满返回false
+func (p *workerPool) submit(task func()) bool {
+	select {
+	case p.tasks <- task:
+		return true
+	default:
+		p.rejected.Add(1)
+		return false
+	}
+}
+
+// submitOrdered 提交需要按key顺序执行的任务 不同key之间并发执行
+// key已经有任务在处理时追加到队列 由正在处理的worker依次执行
+func (p *workerPool) submitOrdered(key string, task func()) bool {
+	p.orderedLock.Lock()
+	defer p.orderedLock.Unlock()
+	if queue, ok := p.ordered[key]; ok {
+		if len(queue) >= cap(p.tasks) {
+			p.rejected.Add(1)
+			return false
+		}
+		p.ordered[key] = append(queue, task)
+		return true
+	}
+	if !p.submit(func() { p.runOrdered(key) }) {
+		return false
+	}
+	p.ordered[key] = []func(){task}
+	return true
+}
+
+func (p *workerPool) runOrdered(key string) {
+	for {
+		p.orderedLock.Lock()
+		queue := p.ordered[key]
+		if len(queue) == 0 {
+			delete(p.ordered, key)
+			p.orderedLock.Unlock()
+			return
+		}
+		task := queue[0]
+		queue[0] = nil
+		p.ordered[key] = queue[1:]
+		p.orderedLock.Unlock()
+		task()
+	}
+}
+
+func (p *workerPool) stats() PoolStats {
+	p.orderedLock.Lock()
+	queued := len(p.tasks)
+	for _, queue := range p.ordered {
+		queued += len(queue)
+	}
+	p.orderedLock.Unlock()
+	return PoolStats{
+		Workers:  p.workers,
+		Queued:   queued,
+		Running:  p.running.Load(),
+		Rejected: p.rejected.Load(),
+		TimedOut: p.timedOut.Load(),
+		Overrun:  p.overrun.Load(),
+	}
+}
@@ -0,0 +1,50 @@
+package node
+
+import (
+	"testing"
+)
+
+func TestWorkerPoolReject(t *testing.T) {
+	p := newWorkerPool(1)
+	block := make(chan struct{})
+	started := make(chan struct{})
+	if !p.submit(func() { close(started); <-block }) {
+		t.Fatal("first task rejected")
+	}
+	<-started
+	//worker被占用 队列容量为1
+	if !p.submit(func() {}) {
+		t.Fatal("queued task rejected")
+	}
+	if p.submit(func() {}) {
+		t.Fatal("task should be rejected when queue is full")
+	}
+	stats := p.stats()
+	if stats.Rejected != 1 || stats.Queued != 1 || stats.Running != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	close(block)
+}
+
+func TestWorkerPoolOrdered(t *testing.T) {
+	p := newWorkerPool(128)
+	var result []int
+	done := make(chan struct{})
+	for i := 0; i < 100; i++ {
+		i := i
+		if !p.submitOrdered("uid:1", func() {
+			result = append(result, i)
+			if i == 99 {
+				close(done)
+			}
+		}) {
+			t.Fatalf("task %d rejected", i)
+		}
+	}
+	<-done
+	for i, v := range result {
+		if i != v {
+			t.Fatalf("task out of order at %d got %d", i, v)
+		}
+	}
+}
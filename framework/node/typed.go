@@ -0,0 +1,52 @@
+package node
+
+import (
+	"common/biz"
+	"common/logs"
+	"encoding/json"
+	"framework/msError"
+	"framework/remote"
+	"github.com/go-playground/validator/v10"
+	"reflect"
+	"strings"
+)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	//校验错误中使用json字段名 和客户端的参数名保持一致
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
+// Handle 注册类型化的handler 自动解析请求并按validate tag校验 失败返回biz.RequestDataError
+//
+//	node.Handle(handlers, "unionHandler.createUnion", unionHandler.CreateUnion)
+func Handle[Req any, Resp any](handlers LogicHandler, router string, fn func(session *remote.Session, req *Req) Resp, dispatch ...DispatchMode) {
+	handlers.Register(router, func(session *remote.Session, msg []byte) any {
+		req := new(Req)
+		if err := json.Unmarshal(msg, req); err != nil {
+			logs.Warn("handler decode request err:%v, router=%s, uid=%s", err, router, session.GetUid())
+			return msError.Result{Code: biz.RequestDataError.Code}
+		}
+		if err := validateRequest(req); err != nil {
+			logs.Warn("handler validate request err:%v, router=%s, uid=%s", err, router, session.GetUid())
+			return msError.Result{Code: biz.RequestDataError.Code}
+		}
+		return fn(session, req)
+	}, dispatch...)
+}
+
+func validateRequest(req any) error {
+	if reflect.Indirect(reflect.ValueOf(req)).Kind() != reflect.Struct {
+		return nil
+	}
+	return validate.Struct(req)
+}
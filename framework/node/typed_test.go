@@ -0,0 +1,36 @@
+package node
+
+import (
+	"common/biz"
+	"common/config"
+	"common/logs"
+	"framework/msError"
+	"framework/remote"
+	"framework/stream"
+	"testing"
+)
+
+type typedTestReq struct {
+	UnionID int64  `json:"unionID" validate:"gt=0"`
+	RoomID  string `json:"roomID"`
+}
+
+func TestHandle(t *testing.T) {
+	config.Conf = new(config.Config)
+	logs.InitLog("node")
+	handlers := make(LogicHandler)
+	Handle(handlers, "unionHandler.joinRoom", func(session *remote.Session, req *typedTestReq) string {
+		return req.RoomID
+	})
+	session := remote.NewSession(nil, &stream.Msg{Uid: "1"})
+	fn := handlers["unionHandler.joinRoom"].Func
+	if res := fn(session, []byte(`{"unionID":1,"roomID":"336842"}`)); res != "336842" {
+		t.Fatalf("unexpected result %v", res)
+	}
+	for _, body := range []string{`{"unionID":0}`, `not json`} {
+		res, ok := fn(session, []byte(body)).(msError.Result)
+		if !ok || res.Code != biz.RequestDataError.Code {
+			t.Fatalf("body %s expect RequestDataError got %v", body, res)
+		}
+	}
+}
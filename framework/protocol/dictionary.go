@@ -0,0 +1,76 @@
+package protocol
+
+import (
+	"sort"
+	"strings"
+)
+
+// Dictionary 路由压缩字典 route <=> uint16
+// 创建后只读，可以被多个连接共享，每个连接在握手时持有一份自己的字典
+type Dictionary struct {
+	routes map[string]uint16 // 路由信息映射为uint16
+	codes  map[uint16]string // uint16映射为路由信息
+}
+
+// NewDictionary 根据已注册的路由生成字典 路由排序后从1开始编号 保证相同的路由集合生成相同的字典
+func NewDictionary(routes []string) *Dictionary {
+	d := &Dictionary{
+		routes: make(map[string]uint16),
+		codes:  make(map[uint16]string),
+	}
+	sorted := make([]string, 0, len(routes))
+	for _, route := range routes {
+		r := strings.TrimSpace(route) //去掉开头结尾的空格
+		if r == "" {
+			continue
+		}
+		if _, ok := d.routes[r]; ok {
+			continue
+		}
+		d.routes[r] = 0
+		sorted = append(sorted, r)
+	}
+	sort.Strings(sorted)
+	for i, r := range sorted {
+		code := uint16(i + 1)
+		d.routes[r] = code
+		d.codes[code] = r
+	}
+	return d
+}
+
+// GetCode 获取路由对应的编号 nil字典表示不启用路由压缩
+func (d *Dictionary) GetCode(route string) (uint16, bool) {
+	if d == nil {
+		return 0, false
+	}
+	code, ok := d.routes[route]
+	return code, ok
+}
+
+func (d *Dictionary) GetRoute(code uint16) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	route, ok := d.codes[code]
+	return route, ok
+}
+
+// Routes 握手时下发给客户端的字典
+func (d *Dictionary) Routes() map[string]uint16 {
+	if d == nil {
+		return nil
+	}
+	res := make(map[string]uint16, len(d.routes))
+	for route, code := range d.routes {
+		res[route] = code
+	}
+	return res
+}
+
+func (d *Dictionary) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.routes)
+}
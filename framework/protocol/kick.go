@@ -0,0 +1,42 @@
+package protocol
+
+import "encoding/json"
+
+// KickReason 服务端踢下线的原因 客户端根据code提示用户
+type KickReason int
+
+const (
+	KickByServer       KickReason = iota // 服务端主动断开
+	KickBlocked                          // 账号被冻结
+	KickMaintenance                      // 服务器维护
+	KickDuplicateLogin                   // 在其他地方登录
+)
+
+var kickReasons = map[KickReason]string{
+	KickByServer:       "连接已断开",
+	KickBlocked:        "账号已被冻结",
+	KickMaintenance:    "服务器维护中",
+	KickDuplicateLogin: "账号在其他地方登录",
+}
+
+func (r KickReason) String() string {
+	if s, ok := kickReasons[r]; ok {
+		return s
+	}
+	return kickReasons[KickByServer]
+}
+
+// KickBody Kick包的内容
+type KickBody struct {
+	Code   KickReason `json:"code"`
+	Reason string     `json:"reason"`
+}
+
+// EncodeKick 编码Kick包 客户端收到后不再重连
+func EncodeKick(reason KickReason) ([]byte, error) {
+	data, err := json.Marshal(KickBody{Code: reason, Reason: reason.String()})
+	if err != nil {
+		return nil, err
+	}
+	return Encode(Kick, data)
+}
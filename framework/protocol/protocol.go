@@ -2,18 +2,11 @@ package protocol
 
 import (
 	"bytes"
-	"common/logs"
 	"compress/zlib"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"io"
-	"strings"
-)
-
-var (
-	routes = make(map[string]uint16) // 路由信息映射为uint16
-	codes  = make(map[uint16]string) // uint16映射为路由信息
 )
 
 type PackageType byte
@@ -56,7 +49,8 @@ type Packet struct {
 	Body any
 }
 
-func Decode(payload []byte) (*Packet, error) {
+// Decode dict是当前连接握手时下发的路由字典 为nil时不解析压缩路由
+func Decode(payload []byte, dict *Dictionary) (*Packet, error) {
 	if len(payload) < HeaderLen {
 		return nil, errors.New("data len invalid")
 	}
@@ -69,13 +63,10 @@ func Decode(payload []byte) (*Packet, error) {
 		if err != nil {
 			return nil, err
 		}
-		if body.Sys.Dict != nil {
-			SetDictionary(body.Sys.Dict)
-		}
 		p.Body = body
 	}
 	if p.Type == Data {
-		m, err := MessageDecode(payload[HeaderLen:])
+		m, err := MessageDecode(payload[HeaderLen:], dict)
 		if err != nil {
 			return nil, err
 		}
@@ -84,33 +75,13 @@ func Decode(payload []byte) (*Packet, error) {
 	return p, nil
 }
 
-func SetDictionary(dict map[string]uint16) {
-	if dict == nil {
-		return
-	}
-
-	for route, code := range dict {
-		r := strings.TrimSpace(route) //去掉开头结尾的空格
-		// duplication check
-		if _, ok := routes[r]; ok {
-			logs.Error("duplicated route(route: %s, code: %d)", r, code)
-			return
-		}
-
-		if _, ok := codes[code]; ok {
-			logs.Error("duplicated route(route: %s, code: %d)", r, code)
-			return
-		}
-
-		// update map, using last value when key duplicated
-		routes[r] = code
-		codes[code] = r
-	}
-}
-func MessageEncode(m *Message) ([]byte, error) {
-	code, compressed := routes[m.Route]
+func MessageEncode(m *Message, dict *Dictionary) ([]byte, error) {
+	code, compressed := dict.GetCode(m.Route)
 	buf := make([]byte, 0)
 	buf = encodeMsgFlag(m.Type, compressed, buf)
+	if m.dataCompressed {
+		buf[0] |= GZIPMask
+	}
 	if msgHasId(m.Type) {
 		buf = encodeMsgId(m, buf)
 	}
@@ -238,8 +209,11 @@ func routable(t MessageType) bool {
 // | response |----010-|<stream id>        |
 // | push     |----011-|<route>             |
 // ------------------------------------------
-func MessageDecode(body []byte) (Message, error) {
+func MessageDecode(body []byte, dict *Dictionary) (Message, error) {
 	m := Message{}
+	if len(body) < msgFlagBytes {
+		return m, errors.New("invalid stream")
+	}
 	flag := body[0]
 	m.Type = MessageType((flag >> 1) & TypeMask)
 	if m.Type < Request || m.Type > Push {
@@ -269,8 +243,11 @@ func MessageDecode(body []byte) (Message, error) {
 		//route解析
 		if flag&RouteCompressMask == 1 {
 			m.routeCompressed = true
+			if offset+2 > dataLen {
+				return m, errors.New("invalid stream")
+			}
 			code := binary.BigEndian.Uint16(body[offset:(offset + 2)])
-			route, found := GetRoute(code)
+			route, found := dict.GetRoute(code)
 			if !found {
 				return m, errors.New("route info not found in dictionary")
 			}
@@ -279,8 +256,14 @@ func MessageDecode(body []byte) (Message, error) {
 
 		} else {
 			m.routeCompressed = false
+			if offset >= dataLen {
+				return m, errors.New("invalid stream")
+			}
 			rl := body[offset]
 			offset++
+			if offset+int(rl) > dataLen {
+				return m, errors.New("invalid stream")
+			}
 			m.Route = string(body[offset:(offset + int(rl))])
 			offset += int(rl)
 		}
@@ -299,9 +282,41 @@ func MessageDecode(body []byte) (Message, error) {
 	return m, nil
 }
 
-func GetRoute(code uint16) (route string, found bool) {
-	route, found = codes[code]
-	return route, found
+// Compress 消息体达到threshold字节时使用zlib压缩 并在flag中设置GZIPMask
+// level为0时使用zlib.DefaultCompression
+func (m *Message) Compress(threshold int, level int) error {
+	if m.dataCompressed || len(m.Data) == 0 || len(m.Data) < threshold {
+		return nil
+	}
+	if level == 0 {
+		level = zlib.DefaultCompression
+	}
+	data, err := DeflateData(m.Data, level)
+	if err != nil {
+		return err
+	}
+	//压缩后反而更大的不压缩
+	if len(data) >= len(m.Data) {
+		return nil
+	}
+	m.Data = data
+	m.dataCompressed = true
+	return nil
+}
+
+func DeflateData(data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func InflateData(data []byte) ([]byte, error) {
@@ -310,7 +325,15 @@ func InflateData(data []byte) ([]byte, error) {
 		return nil, err
 	}
 	defer zr.Close()
-	return io.ReadAll(zr)
+	//解压后的大小同样限制在MaxPacketSize以内 避免很小的压缩包解压出大量数据
+	buf, err := io.ReadAll(io.LimitReader(zr, MaxPacketSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) > MaxPacketSize {
+		return nil, errors.New("inflate data size too big")
+	}
+	return buf, nil
 }
 
 func Encode(packageType PackageType, body []byte) ([]byte, error) {
@@ -355,6 +378,7 @@ type Sys struct {
 	Heartbeat    uint8             `json:"heartbeat"`
 	Dict         map[string]uint16 `json:"dict"`
 	Serializer   string            `json:"serializer"`
+	Compress     bool              `json:"compress"`
 }
 
 type HandshakeResponse struct {
@@ -368,5 +392,6 @@ type Message struct {
 	Route           string      // route for locating service 消息路由
 	Data            []byte      // payload  消息体的原始数据
 	routeCompressed bool        // is route Compressed 是否启用路由压缩
+	dataCompressed  bool        // 消息体是否已经zlib压缩
 	Error           bool        // response error
 }
@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestMessageCompress(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"pushRouter":"GameReviewPushData"}`), 100)
+	m := &Message{Type: Push, Route: "ServerMessagePush", Data: data}
+	if err := m.Compress(1024, 0); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := MessageEncode(m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf[0]&GZIPMask != GZIPMask {
+		t.Fatal("GZIPMask not set")
+	}
+	res, err := MessageDecode(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Route != m.Route || !bytes.Equal(res.Data, data) {
+		t.Fatalf("decode got route=%s len=%d", res.Route, len(res.Data))
+	}
+}
+
+func TestInflateDataLimit(t *testing.T) {
+	data, err := DeflateData(make([]byte, MaxPacketSize+1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InflateData(data); err == nil {
+		t.Fatal("expect inflate err when data exceeds MaxPacketSize")
+	}
+	data, err = DeflateData(make([]byte, 1024), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := InflateData(data); err != nil || len(res) != 1024 {
+		t.Fatalf("inflate got len=%d err=%v", len(res), err)
+	}
+}
+
+func TestMessageDecodeTruncatedRoute(t *testing.T) {
+	m := &Message{Type: Request, ID: 1, Route: "hall.userHandler.updateUserAddress", Data: []byte(`{}`)}
+	buf, err := MessageEncode(m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//只有id没有route长度 以及route长度超过消息长度
+	for _, n := range []int{2, 10} {
+		if _, err := MessageDecode(buf[:n], nil); err == nil {
+			t.Fatalf("expect decode err with %d bytes", n)
+		}
+	}
+}
+
+func TestMessageCompressBelowThreshold(t *testing.T) {
+	m := &Message{Type: Push, Route: "ServerMessagePush", Data: []byte(`{"code":0}`)}
+	if err := m.Compress(1024, 0); err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := MessageEncode(m, nil)
+	if buf[0]&GZIPMask != 0 {
+		t.Fatal("small body should not be compressed")
+	}
+}
+
+func TestMessageRouteDictionary(t *testing.T) {
+	dict := NewDictionary([]string{"hall.userHandler.bindPhone", "game.unionHandler.joinRoom"})
+	m := &Message{Type: Request, ID: 300, Route: "game.unionHandler.joinRoom", Data: []byte(`{}`)}
+	buf, err := MessageEncode(m, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf[0]&RouteCompressMask != RouteCompressMask {
+		t.Fatal("route should be compressed")
+	}
+	res, err := MessageDecode(buf, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Route != m.Route || res.ID != m.ID {
+		t.Fatalf("decode got route=%s id=%d", res.Route, res.ID)
+	}
+	if _, err := MessageDecode(buf, nil); err == nil {
+		t.Fatal("compressed route without dictionary should fail")
+	}
+}
+
+func TestEncodeKick(t *testing.T) {
+	buf, err := EncodeKick(KickDuplicateLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if PackageType(buf[0]) != Kick {
+		t.Fatalf("package type got %d", buf[0])
+	}
+	var body KickBody
+	if err := json.Unmarshal(buf[HeaderLen:], &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != KickDuplicateLogin || body.Reason == "" {
+		t.Fatalf("kick body got %+v", body)
+	}
+}
@@ -0,0 +1,158 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"strings"
+	"sync"
+)
+
+const (
+	JsonSerializerName     = "json"
+	ProtobufSerializerName = "protobuf"
+	MsgpackSerializerName  = "msgpack"
+)
+
+// Serializer Data包消息体的编解码器 客户端在Handshake时通过Sys.Serializer选择
+type Serializer interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	serializerLock sync.RWMutex
+	serializers    = map[string]Serializer{
+		JsonSerializerName:     &JsonSerializer{},
+		ProtobufSerializerName: &ProtobufSerializer{},
+		MsgpackSerializerName:  &MsgpackSerializer{},
+	}
+)
+
+// RegisterSerializer 注册自定义的编解码器，同名会覆盖
+func RegisterSerializer(s Serializer) {
+	serializerLock.Lock()
+	defer serializerLock.Unlock()
+	serializers[strings.ToLower(s.Name())] = s
+}
+
+// GetSerializer 根据名称获取编解码器 名称为空时返回json
+func GetSerializer(name string) (Serializer, bool) {
+	if name == "" {
+		return DefaultSerializer(), true
+	}
+	serializerLock.RLock()
+	defer serializerLock.RUnlock()
+	s, ok := serializers[strings.ToLower(name)]
+	return s, ok
+}
+
+// DefaultSerializer 默认使用json 兼容原有客户端
+func DefaultSerializer() Serializer {
+	serializerLock.RLock()
+	defer serializerLock.RUnlock()
+	return serializers[JsonSerializerName]
+}
+
+// SerializerOrDefault 找不到对应的编解码器时回退到json
+func SerializerOrDefault(name string) Serializer {
+	if s, ok := GetSerializer(name); ok {
+		return s
+	}
+	return DefaultSerializer()
+}
+
+// Transcode 将消息体从一种编码转换为另一种编码
+func Transcode(data []byte, from Serializer, to Serializer) ([]byte, error) {
+	if from == nil || to == nil || from.Name() == to.Name() || len(data) == 0 {
+		return data, nil
+	}
+	var v any
+	if err := from.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return to.Marshal(v)
+}
+
+type JsonSerializer struct{}
+
+func (s *JsonSerializer) Name() string {
+	return JsonSerializerName
+}
+
+func (s *JsonSerializer) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (s *JsonSerializer) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufSerializer proto.Message直接编码
+// 其他类型（handler返回的map、结构体）先转为google.protobuf.Value再编码 客户端用标准的Value解析即可
+type ProtobufSerializer struct{}
+
+func (s *ProtobufSerializer) Name() string {
+	return ProtobufSerializerName
+}
+
+func (s *ProtobufSerializer) Marshal(v any) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	value := &structpb.Value{}
+	if err := protojson.Unmarshal(data, value); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(value)
+}
+
+func (s *ProtobufSerializer) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	value := &structpb.Value{}
+	if err := proto.Unmarshal(data, value); err != nil {
+		return err
+	}
+	if value.GetKind() == nil {
+		return errors.New("protobuf body is not a google.protobuf.Value")
+	}
+	jsonData, err := protojson.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, v)
+}
+
+// MsgpackSerializer 使用json tag作为字段名 和json编码的字段保持一致
+type MsgpackSerializer struct{}
+
+func (s *MsgpackSerializer) Name() string {
+	return MsgpackSerializerName
+}
+
+func (s *MsgpackSerializer) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *MsgpackSerializer) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"testing"
+)
+
+type serializerTestData struct {
+	RoomID string `json:"roomID"`
+	Score  int    `json:"score"`
+}
+
+func TestSerializerRoundTrip(t *testing.T) {
+	for _, name := range []string{JsonSerializerName, ProtobufSerializerName, MsgpackSerializerName} {
+		s, ok := GetSerializer(name)
+		if !ok {
+			t.Fatalf("serializer %s not registered", name)
+		}
+		data, err := s.Marshal(serializerTestData{RoomID: "336842", Score: 10})
+		if err != nil {
+			t.Fatalf("%s marshal err:%v", name, err)
+		}
+		var res serializerTestData
+		if err := s.Unmarshal(data, &res); err != nil {
+			t.Fatalf("%s unmarshal err:%v", name, err)
+		}
+		if res.RoomID != "336842" || res.Score != 10 {
+			t.Fatalf("%s round trip got %+v", name, res)
+		}
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	msgpackSerializer, _ := GetSerializer(MsgpackSerializerName)
+	data, err := msgpackSerializer.Marshal(map[string]any{"roomID": "336842"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonData, err := Transcode(data, msgpackSerializer, DefaultSerializer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(jsonData) != `{"roomID":"336842"}` {
+		t.Fatalf("transcode got %s", jsonData)
+	}
+}
@@ -2,6 +2,8 @@ package pusher
 
 import (
 	"common/logs"
+	"common/metrics"
+	"context"
 	"encoding/json"
 	"framework/protocol"
 	"framework/remote"
@@ -13,17 +15,31 @@ var _pusher *Pusher
 type Pusher struct {
 	client   remote.Client
 	pushChan chan *stream.PushMessage
+	//查询用户所在的connector 踢人时使用
+	onlineLookup OnlineLookup
+	//通过心跳发现的存活的connector 查不到用户所在的connector时使用
+	connectors func() []string
 }
 
+// OnlineLookup 查询用户当前所在的connector 不在线时返回空
+type OnlineLookup func(ctx context.Context, uid string) (string, error)
+
 func GetPusher() *Pusher {
 	return _pusher
 }
 
 func (p *Pusher) Push(m *stream.Msg, users []stream.PushUser, data any, router string) {
-	msgData, _ := json.Marshal(data)
+	//按发起请求的session选择的编码推送 connector会为编码不同的客户端转码
+	serializer := protocol.SerializerOrDefault(m.Serializer)
+	msgData, err := serializer.Marshal(data)
+	if err != nil {
+		logs.Error("push marshal err:%v, serializer=%s", err, serializer.Name())
+		return
+	}
 	pm := stream.PushData{
-		Data:   msgData,
-		Router: router,
+		Data:       msgData,
+		Router:     router,
+		Serializer: serializer.Name(),
 	}
 	upm := &stream.PushMessage{
 		Users:    users,
@@ -39,10 +55,13 @@ func (p *Pusher) pushChanRead() {
 		case data := <-p.pushChan:
 			pushMessage := protocol.Message{
 				Type:  protocol.Push,
-				ID:    data.Msg.Body.ID,
 				Route: data.PushData.Router,
 				Data:  data.PushData.Data,
 			}
+			//节点主动推送时没有客户端请求
+			if data.Msg.Body != nil {
+				pushMessage.ID = data.Msg.Body.ID
+			}
 			userMap := make(map[string][]string)
 			for _, v := range data.Users {
 				//将同一个目的地的到一起
@@ -61,18 +80,72 @@ func (p *Pusher) pushChanRead() {
 					Uid:         data.Msg.Uid,
 					PushUser:    uids,
 					SessionType: stream.Normal,
+					Serializer:  data.PushData.Serializer,
+					TraceId:     data.Msg.TraceId,
+					SpanId:      data.Msg.SpanId,
 				}
 				result, _ := json.Marshal(msgData)
 				err := p.client.SendMsg(msgData.Dst, result)
 				if err != nil {
 					logs.Error("push stream err:%v, stream=%v", err, msgData)
+					continue
 				}
+				metrics.MessagesOut.WithLabelValues(pushMessage.Route).Inc()
 			}
 
 		}
 	}
 }
 
+// Kick 将用户踢下线 持有该用户连接的connector发送Kick包并断开连接
+func Kick(uid string, reason protocol.KickReason) {
+	if _pusher == nil {
+		logs.Error("kick user fail, pusher not init, uid=%s", uid)
+		return
+	}
+	_pusher.Kick(uid, reason)
+}
+
+// Kick 先根据在线注册表发送给用户所在的connector 查不到时发送给所有存活的connector
+func (p *Pusher) Kick(uid string, reason protocol.KickReason) {
+	if p.onlineLookup != nil {
+		connectorId, err := p.onlineLookup(context.Background(), uid)
+		if err != nil {
+			logs.Error("kick user lookup online err:%v, uid=%s", err, uid)
+		} else if connectorId != "" {
+			p.KickOn(connectorId, uid, reason)
+			return
+		}
+	}
+	if p.connectors == nil {
+		logs.Error("kick user fail, no connector found, uid=%s", uid)
+		return
+	}
+	for _, connectorId := range p.connectors() {
+		p.KickOn(connectorId, uid, reason)
+	}
+}
+
+// KickOn 已知用户所在的connector时直接发送给该connector
+func (p *Pusher) KickOn(connectorId string, uid string, reason protocol.KickReason) {
+	msg := stream.Msg{
+		Dst:         connectorId,
+		Uid:         uid,
+		SessionType: stream.Kick,
+		KickReason:  reason,
+	}
+	data, _ := json.Marshal(msg)
+	if err := p.client.SendMsg(connectorId, data); err != nil {
+		logs.Error("kick user err:%v, uid=%s, connector=%s", err, uid, connectorId)
+	}
+}
+
+// SetDiscovery 设置踢人时查找connector的方式 lookup可以为空
+func (p *Pusher) SetDiscovery(lookup OnlineLookup, connectors func() []string) {
+	p.onlineLookup = lookup
+	p.connectors = connectors
+}
+
 func NewPusher(client remote.Client) {
 	_pusher = &Pusher{
 		client:   client,
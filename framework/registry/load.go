@@ -0,0 +1,29 @@
+package registry
+
+// LoadHalfWeight 负载分数达到这个值时 加权轮询中节点的有效权重减半
+const LoadHalfWeight = 100
+
+// Load 节点随心跳上报的负载
+type Load struct {
+	Running    int `json:"running"`    //正在执行的handler数
+	Queued     int `json:"queued"`     //排队等待处理的消息数
+	Workers    int `json:"workers"`    //handler worker数量
+	Rooms      int `json:"rooms"`      //game节点当前的房间数
+	Goroutines int `json:"goroutines"` //协程数
+}
+
+// Score 负载分数 正在处理和排队的handler加上房间数 越小越空闲
+func (l *Load) Score() int {
+	return l.Running + l.Queued + l.Rooms
+}
+
+// EffectiveWeight 根据负载调整后的权重 配置的权重为0时按1处理
+func EffectiveWeight(weight int, score int) float64 {
+	if weight <= 0 {
+		weight = 1
+	}
+	if score < 0 {
+		score = 0
+	}
+	return float64(weight) * LoadHalfWeight / float64(score+LoadHalfWeight)
+}
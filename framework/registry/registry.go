@@ -0,0 +1,173 @@
+package registry
+
+import (
+	"framework/game"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Subject 节点心跳 上下线和路由通告使用的广播地址 connector和所有节点都会订阅
+const Subject = "cluster.discovery"
+
+// ConnectorType connector心跳中的节点类型 节点据此找到存活的connector
+const ConnectorType = "connector"
+
+const (
+	// HeartbeatInterval 节点发送心跳的间隔
+	HeartbeatInterval = 3 * time.Second
+	// ExpireTime 超过这个时间没有收到心跳就认为节点已下线
+	ExpireTime = 3 * HeartbeatInterval
+)
+
+type member struct {
+	conf     *game.ServersConfig
+	lastSeen time.Time
+	draining bool
+}
+
+// Registry 当前存活的节点 由心跳维护 connector根据它选择转发的节点
+type Registry struct {
+	sync.RWMutex
+	members  map[string]*member
+	onChange []func(serverType string)
+}
+
+func New() *Registry {
+	return &Registry{
+		members: make(map[string]*member),
+	}
+}
+
+// Seed 使用servers.json中的节点初始化 避免启动时还没收到心跳没有节点可用 一直没有心跳的会正常过期
+func (r *Registry) Seed(servers []*game.ServersConfig, now time.Time) {
+	for _, v := range servers {
+		r.Update(v, now)
+	}
+}
+
+// Update 收到心跳 新节点返回true
+func (r *Registry) Update(conf *game.ServersConfig, now time.Time) bool {
+	if conf == nil || conf.ID == "" {
+		return false
+	}
+	r.Lock()
+	m, ok := r.members[conf.ID]
+	if ok {
+		m.conf = conf
+		m.lastSeen = now
+		r.Unlock()
+		return false
+	}
+	r.members[conf.ID] = &member{conf: conf, lastSeen: now}
+	r.Unlock()
+	r.changed(conf.ServerType)
+	return true
+}
+
+// Remove 节点主动下线
+func (r *Registry) Remove(serverId string) bool {
+	r.Lock()
+	m, ok := r.members[serverId]
+	if ok {
+		delete(r.members, serverId)
+	}
+	r.Unlock()
+	if ok {
+		r.changed(m.conf.ServerType)
+	}
+	return ok
+}
+
+// SetDraining 节点进入排空状态后不再分配新的请求
+func (r *Registry) SetDraining(serverId string, draining bool) {
+	r.Lock()
+	m, ok := r.members[serverId]
+	changed := ok && m.draining != draining
+	if changed {
+		m.draining = draining
+	}
+	r.Unlock()
+	if changed {
+		r.changed(m.conf.ServerType)
+	}
+}
+
+// Available 节点存活并且没有在排空
+func (r *Registry) Available(serverId string) bool {
+	r.RLock()
+	defer r.RUnlock()
+	m, ok := r.members[serverId]
+	return ok && !m.draining
+}
+
+// Sweep 移除心跳超时的节点 返回被移除的节点id
+func (r *Registry) Sweep(now time.Time) []string {
+	r.Lock()
+	removed := make([]string, 0)
+	types := make(map[string]struct{})
+	for id, m := range r.members {
+		if now.Sub(m.lastSeen) > ExpireTime {
+			delete(r.members, id)
+			removed = append(removed, id)
+			types[m.conf.ServerType] = struct{}{}
+		}
+	}
+	r.Unlock()
+	for serverType := range types {
+		r.changed(serverType)
+	}
+	return removed
+}
+
+// Servers 某个类型的存活节点 按id排序 保证轮询等策略的顺序稳定
+// 排空中的节点不参与选择 只剩排空中的节点时仍然返回 由节点自己拒绝新的请求
+func (r *Registry) Servers(serverType string) []*game.ServersConfig {
+	r.RLock()
+	defer r.RUnlock()
+	servers := make([]*game.ServersConfig, 0)
+	draining := make([]*game.ServersConfig, 0)
+	for _, m := range r.members {
+		if m.conf.ServerType != serverType {
+			continue
+		}
+		if m.draining {
+			draining = append(draining, m.conf)
+		} else {
+			servers = append(servers, m.conf)
+		}
+	}
+	if len(servers) == 0 {
+		servers = draining
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].ID < servers[j].ID
+	})
+	return servers
+}
+
+// Get 存活节点的配置 不存在返回nil
+func (r *Registry) Get(serverId string) *game.ServersConfig {
+	r.RLock()
+	defer r.RUnlock()
+	if m, ok := r.members[serverId]; ok {
+		return m.conf
+	}
+	return nil
+}
+
+// OnChange 某个类型的节点上线或下线时回调 需要在收到心跳之前注册
+func (r *Registry) OnChange(fn func(serverType string)) {
+	r.Lock()
+	defer r.Unlock()
+	r.onChange = append(r.onChange, fn)
+}
+
+func (r *Registry) changed(serverType string) {
+	r.RLock()
+	fns := r.onChange
+	r.RUnlock()
+	for _, fn := range fns {
+		fn(serverType)
+	}
+}
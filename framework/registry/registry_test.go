@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"framework/game"
+	"testing"
+	"time"
+)
+
+func TestRegistryHeartbeat(t *testing.T) {
+	r := New()
+	changes := 0
+	r.OnChange(func(serverType string) {
+		changes++
+	})
+	now := time.Now()
+	r.Seed([]*game.ServersConfig{
+		{ID: "game-002", ServerType: "game"},
+		{ID: "hall-001", ServerType: "hall"},
+	}, now)
+	if !r.Update(&game.ServersConfig{ID: "game-001", ServerType: "game"}, now) {
+		t.Fatal("game-001 should be new")
+	}
+	if r.Update(&game.ServersConfig{ID: "game-001", ServerType: "game"}, now) {
+		t.Fatal("game-001 heartbeat again should not be new")
+	}
+	servers := r.Servers("game")
+	if len(servers) != 2 || servers[0].ID != "game-001" || servers[1].ID != "game-002" {
+		t.Fatalf("unexpected game servers: %v", servers)
+	}
+	//game-001继续心跳 game-002和hall-001超时
+	r.Update(&game.ServersConfig{ID: "game-001", ServerType: "game"}, now.Add(ExpireTime))
+	removed := r.Sweep(now.Add(ExpireTime + time.Second))
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 expired servers, got %v", removed)
+	}
+	if r.Get("game-002") != nil || len(r.Servers("hall")) != 0 {
+		t.Fatal("expired servers should be removed")
+	}
+	if !r.Remove("game-001") || len(r.Servers("game")) != 0 {
+		t.Fatal("game-001 should leave")
+	}
+	if changes != 6 {
+		t.Fatalf("expected 6 changes, got %d", changes)
+	}
+}
+
+func TestEffectiveWeight(t *testing.T) {
+	if w := EffectiveWeight(0, 0); w != 1 {
+		t.Fatalf("zero weight should be treated as 1, got %v", w)
+	}
+	if w := EffectiveWeight(4, LoadHalfWeight); w != 2 {
+		t.Fatalf("weight should be halved at LoadHalfWeight, got %v", w)
+	}
+	if EffectiveWeight(2, 10) <= EffectiveWeight(2, 50) {
+		t.Fatal("higher load should have lower weight")
+	}
+}
+
+func TestRegistryDraining(t *testing.T) {
+	r := New()
+	now := time.Now()
+	r.Update(&game.ServersConfig{ID: "game-001", ServerType: "game"}, now)
+	r.Update(&game.ServersConfig{ID: "game-002", ServerType: "game"}, now)
+	r.SetDraining("game-001", true)
+	if r.Available("game-001") || !r.Available("game-002") {
+		t.Fatal("draining server should not be available")
+	}
+	if servers := r.Servers("game"); len(servers) != 1 || servers[0].ID != "game-002" {
+		t.Fatalf("draining server should not be selected: %v", servers)
+	}
+	//只剩排空中的节点时仍然返回 由节点自己拒绝
+	r.SetDraining("game-002", true)
+	if servers := r.Servers("game"); len(servers) != 2 {
+		t.Fatalf("expected draining servers as fallback: %v", servers)
+	}
+}
@@ -1,7 +1,21 @@
 package remote
 
+import "context"
+
 type Client interface {
 	Run() error
 	SendMsg(string, []byte) error
+	// Subscribe 额外订阅一个地址 比如广播地址 收到的消息同样进入readChan
+	Subscribe(subject string) error
+	// Call 同步调用 发送data到dst并等待回复 ctx没有设置超时时由实现方决定超时时间
+	Call(ctx context.Context, dst string, data []byte) ([]byte, error)
 	Close() error
 }
+
+// ClientBuilder 创建节点间通信的客户端 readChan接收发给serverId的消息
+type ClientBuilder func(serverId string, readChan chan []byte) Client
+
+// NatsClientBuilder 默认使用nats通信
+func NatsClientBuilder(serverId string, readChan chan []byte) Client {
+	return NewNatsClient(serverId, readChan)
+}
@@ -0,0 +1,137 @@
+package remote
+
+import (
+	"common/logs"
+	"context"
+	"fmt"
+	"framework/msError"
+	"sync"
+	"sync/atomic"
+)
+
+// LocalBus 进程内的消息总线 单进程模式下代替nats 按serverId投递消息
+type LocalBus struct {
+	sync.RWMutex
+	subs  map[string][]chan []byte
+	inbox atomic.Int64
+}
+
+func NewLocalBus() *LocalBus {
+	return &LocalBus{
+		subs: make(map[string][]chan []byte),
+	}
+}
+
+// Builder 创建使用当前bus通信的客户端
+func (b *LocalBus) Builder() ClientBuilder {
+	return func(serverId string, readChan chan []byte) Client {
+		return &LocalClient{
+			serverId: serverId,
+			readChan: readChan,
+			bus:      b,
+		}
+	}
+}
+
+// subscribe 同一地址可以有多个订阅者 比如广播地址
+func (b *LocalBus) subscribe(subject string, ch chan []byte) {
+	b.Lock()
+	defer b.Unlock()
+	b.subs[subject] = append(b.subs[subject], ch)
+}
+
+func (b *LocalBus) unsubscribe(subject string, ch chan []byte) {
+	b.Lock()
+	defer b.Unlock()
+	subs := b.subs[subject]
+	for i, v := range subs {
+		if v == ch {
+			subs = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(b.subs, subject)
+		return
+	}
+	b.subs[subject] = subs
+}
+
+// publish 没有订阅者时返回false 和nats一样消息直接丢弃 订阅者的队列满了时也丢弃
+func (b *LocalBus) publish(subject string, data []byte) bool {
+	b.RLock()
+	subs := b.subs[subject]
+	b.RUnlock()
+	if len(subs) == 0 {
+		return false
+	}
+	for _, ch := range subs {
+		msg := make([]byte, len(data))
+		copy(msg, data)
+		select {
+		case ch <- msg:
+		default:
+			//接收方的队列满了 和nats的慢消费者一样丢弃 不阻塞发送方 避免两个节点互相等待
+			logs.Error("local bus subscriber queue full, msg dropped, subject=%s", subject)
+		}
+	}
+	return true
+}
+
+// LocalClient 进程内实现的remote.Client 用于本地开发和集成测试 不需要nats服务
+type LocalClient struct {
+	serverId string
+	readChan chan []byte
+	bus      *LocalBus
+	subjects []string
+}
+
+func (c *LocalClient) Run() error {
+	c.bus.subscribe(c.serverId, c.readChan)
+	return nil
+}
+
+func (c *LocalClient) Subscribe(subject string) error {
+	c.bus.subscribe(subject, c.readChan)
+	c.subjects = append(c.subjects, subject)
+	return nil
+}
+
+func (c *LocalClient) SendMsg(dst string, data []byte) error {
+	if !c.bus.publish(dst, data) {
+		logs.Warn("local client send msg no subscriber, dst=%s", dst)
+	}
+	return nil
+}
+
+// Call 为每次调用生成一个回复地址 等待对方回复或者超时
+func (c *LocalClient) Call(ctx context.Context, dst string, data []byte) ([]byte, error) {
+	ctx, cancel := callContext(ctx, dst)
+	defer cancel()
+	inbox := fmt.Sprintf("_INBOX.%s.%d", c.serverId, c.bus.inbox.Add(1))
+	replyChan := make(chan []byte, 1)
+	c.bus.subscribe(inbox, replyChan)
+	defer c.bus.unsubscribe(inbox, replyChan)
+	request, err := withReply(data, inbox)
+	if err != nil {
+		return nil, msError.NewError(msError.RPCFail.Code, err)
+	}
+	if !c.bus.publish(dst, request) {
+		return nil, msError.RPCNoResponders
+	}
+	select {
+	case response := <-replyChan:
+		return response, nil
+	case <-ctx.Done():
+		logs.Error("local call err:%v, dst=%s", ctx.Err(), dst)
+		return nil, msError.RPCTimeout
+	}
+}
+
+func (c *LocalClient) Close() error {
+	c.bus.unsubscribe(c.serverId, c.readChan)
+	for _, subject := range c.subjects {
+		c.bus.unsubscribe(subject, c.readChan)
+	}
+	return nil
+}
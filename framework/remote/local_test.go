@@ -0,0 +1,72 @@
+package remote
+
+import (
+	"common/config"
+	"common/logs"
+	"context"
+	"encoding/json"
+	"framework/msError"
+	"framework/stream"
+	"testing"
+	"time"
+)
+
+func TestLocalClientCall(t *testing.T) {
+	config.Conf = new(config.Config)
+	logs.InitLog("remote")
+	bus := NewLocalBus()
+	hallChan := make(chan []byte, 8)
+	gameChan := make(chan []byte, 8)
+	hall := bus.Builder()("hall-001", hallChan)
+	gameCli := bus.Builder()("game-001", gameChan)
+	_ = hall.Run()
+	_ = gameCli.Run()
+	//game节点 收到rpc请求后原样返回
+	go func() {
+		for data := range gameChan {
+			var msg stream.Msg
+			_ = json.Unmarshal(data, &msg)
+			res, _ := json.Marshal(stream.Msg{Src: msg.Dst, Dst: msg.Src, Body: msg.Body, Reply: msg.Reply})
+			_ = gameCli.SendMsg(msg.Reply, res)
+		}
+	}()
+	res, err := Call(context.Background(), hall, &stream.Msg{Src: "hall-001", Dst: "game-001"}, "unionHandler.getUnionRoomList", map[string]any{"unionID": 1})
+	if err != nil {
+		t.Fatalf("call err:%v", err)
+	}
+	if string(res) != `{"unionID":1}` {
+		t.Fatalf("unexpected response %s", res)
+	}
+	_, err = Call(context.Background(), hall, &stream.Msg{Src: "hall-001", Dst: "game-002"}, "unionHandler.getUnionRoomList", nil)
+	if err != msError.RPCNoResponders {
+		t.Fatalf("expect RPCNoResponders got %v", err)
+	}
+	_ = gameCli.Close()
+	_ = bus.Builder()("game-001", make(chan []byte, 1)).Run()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = Call(ctx, hall, &stream.Msg{Src: "hall-001", Dst: "game-001"}, "unionHandler.getUnionRoomList", nil)
+	if err != msError.RPCTimeout {
+		t.Fatalf("expect RPCTimeout got %v", err)
+	}
+}
+
+func TestLocalBusDropsWhenQueueFull(t *testing.T) {
+	config.Conf = new(config.Config)
+	logs.InitLog("remote")
+	bus := NewLocalBus()
+	gameChan := make(chan []byte, 1)
+	_ = bus.Builder()("game-001", gameChan).Run()
+	hall := bus.Builder()("hall-001", make(chan []byte, 1))
+	_ = hall.SendMsg("game-001", []byte("1"))
+	//队列满了 发送方不阻塞 消息丢弃
+	_ = hall.SendMsg("game-001", []byte("2"))
+	if got := string(<-gameChan); got != "1" {
+		t.Fatalf("unexpected msg %s", got)
+	}
+	select {
+	case data := <-gameChan:
+		t.Fatalf("dropped msg delivered %s", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
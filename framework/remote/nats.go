@@ -2,7 +2,10 @@ package remote
 
 import (
 	"common/logs"
+	"context"
+	"errors"
 	"framework/game"
+	"framework/msError"
 	"github.com/nats-io/nats.go"
 )
 
@@ -29,6 +32,20 @@ func (c *NatsClient) Run() error {
 	go c.sub()
 	return nil
 }
+
+// Subscribe 订阅广播地址 广播消息不需要回复
+func (c *NatsClient) Subscribe(subject string) error {
+	if c.conn == nil {
+		return nats.ErrConnectionClosed
+	}
+	_, err := c.conn.Subscribe(subject, func(msg *nats.Msg) {
+		c.readChan <- msg.Data
+	})
+	if err != nil {
+		logs.Error("nats subscribe err:%v, subject=%s", err, subject)
+	}
+	return err
+}
 func (c *NatsClient) Close() error {
 	if c.conn != nil {
 		c.conn.Close()
@@ -39,7 +56,17 @@ func (c *NatsClient) Close() error {
 func (c *NatsClient) sub() {
 	_, err := c.conn.Subscribe(c.serverId, func(msg *nats.Msg) {
 		//收到的其他nats client发送的消息
-		c.readChan <- msg.Data
+		if msg.Reply == "" {
+			c.readChan <- msg.Data
+			return
+		}
+		//rpc调用 把回复地址放入消息中 handler处理完后发送到回复地址
+		data, err := withReply(msg.Data, msg.Reply)
+		if err != nil {
+			logs.Error("nats sub unmarshal rpc msg err:%v", err)
+			return
+		}
+		c.readChan <- data
 	})
 	if err != nil {
 		logs.Error("nats sub err:%v", err)
@@ -51,3 +78,24 @@ func (c *NatsClient) SendMsg(dst string, data []byte) error {
 	}
 	return nil
 }
+
+// Call 使用nats的request/reply同步调用 超时时间优先使用ctx 其次是目标服务配置的rpcTimeOut
+func (c *NatsClient) Call(ctx context.Context, dst string, data []byte) ([]byte, error) {
+	if c.conn == nil {
+		return nil, msError.RPCNoResponders
+	}
+	ctx, cancel := callContext(ctx, dst)
+	defer cancel()
+	msg, err := c.conn.RequestWithContext(ctx, dst, data)
+	if err != nil {
+		logs.Error("nats call err:%v, dst=%s", err, dst)
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, msError.RPCTimeout
+		}
+		if errors.Is(err, nats.ErrNoResponders) {
+			return nil, msError.RPCNoResponders
+		}
+		return nil, msError.RPCFail
+	}
+	return msg.Data, nil
+}
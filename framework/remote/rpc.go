@@ -0,0 +1,124 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"framework/game"
+	"framework/msError"
+	"framework/protocol"
+	"framework/stream"
+	"time"
+)
+
+// defaultRPCTimeOut 配置中没有设置rpcTimeOut时使用 单位秒
+const defaultRPCTimeOut = 3
+
+// callContext ctx没有设置超时时 使用目标服务配置的rpcTimeOut
+func callContext(ctx context.Context, dst string) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	timeout := defaultRPCTimeOut
+	if game.Conf != nil {
+		if serverConfig := game.Conf.GetServersConfig(dst); serverConfig != nil && serverConfig.RPCTimeOut > 0 {
+			timeout = serverConfig.RPCTimeOut
+		}
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+}
+
+// withReply 把回复地址放入消息中 handler处理完后发送到回复地址
+func withReply(data []byte, reply string) ([]byte, error) {
+	var remoteMsg stream.Msg
+	if err := json.Unmarshal(data, &remoteMsg); err != nil {
+		return nil, err
+	}
+	remoteMsg.Reply = reply
+	return json.Marshal(remoteMsg)
+}
+
+// Call 同步调用dst节点上的route 返回handler结果的json数据
+// 传输错误返回msError中的RPC错误码 业务错误由调用方解析返回结果得到
+func Call(ctx context.Context, client Client, msg *stream.Msg, route string, req any) ([]byte, *msError.Error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, msError.NewError(msError.RPCFail.Code, err)
+	}
+	msg.Router = route
+	msg.Body = &protocol.Message{
+		Type:  protocol.Request,
+		Route: route,
+		Data:  data,
+	}
+	//rpc统一使用json 不使用客户端的编码
+	msg.Serializer = ""
+	request, _ := json.Marshal(msg)
+	response, err := client.Call(ctx, msg.Dst, request)
+	if err != nil {
+		if e, ok := err.(*msError.Error); ok {
+			return nil, e
+		}
+		return nil, msError.NewError(msError.RPCFail.Code, err)
+	}
+	var responseMsg stream.Msg
+	if err := json.Unmarshal(response, &responseMsg); err != nil {
+		return nil, msError.NewError(msError.RPCFail.Code, err)
+	}
+	if responseMsg.Code != 0 {
+		return nil, msError.CodeError(responseMsg.Code, responseMsg.ErrMsg)
+	}
+	if responseMsg.Body == nil {
+		return nil, nil
+	}
+	return responseMsg.Body.Data, nil
+}
+
+// Call 以当前用户的身份同步调用其他节点 比如hall向game查询房间列表
+func (s *Session) Call(ctx context.Context, dst string, route string, req any) ([]byte, *msError.Error) {
+	s.RLock()
+	data := &stream.SessionData{
+		AllData:    make(map[string]any, len(s.data.AllData)),
+		SingleData: make(map[string]any, len(s.data.SingleData)),
+	}
+	for k, v := range s.data.AllData {
+		data.AllData[k] = v
+	}
+	for k, v := range s.data.SingleData {
+		data.SingleData[k] = v
+	}
+	s.RUnlock()
+	msg := &stream.Msg{
+		Cid:         s.msg.Cid,
+		Uid:         s.msg.Uid,
+		Src:         s.serverId,
+		Dst:         dst,
+		ConnectorId: s.msg.ConnectorId,
+		SessionData: data,
+		TraceId:     s.msg.TraceId,
+		SpanId:      s.msg.SpanId,
+	}
+	return Call(ctx, s.client, msg, route, req)
+}
+
+// Notify 单向通知dst上的route 不等待回复 dst可以是多个节点订阅的广播地址
+func (s *Session) Notify(dst string, route string, req any) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	msg := &stream.Msg{
+		Uid:    s.msg.Uid,
+		Src:    s.serverId,
+		Dst:    dst,
+		Router: route,
+		Body: &protocol.Message{
+			Type:  protocol.Notify,
+			Route: route,
+			Data:  data,
+		},
+		TraceId: s.msg.TraceId,
+		SpanId:  s.msg.SpanId,
+	}
+	res, _ := json.Marshal(msg)
+	return s.client.SendMsg(dst, res)
+}
@@ -2,7 +2,9 @@ package remote
 
 import (
 	"common/logs"
+	"context"
 	"encoding/json"
+	"framework/protocol"
 	"framework/stream"
 	"sync"
 )
@@ -15,6 +17,7 @@ type Session struct {
 	data            *stream.SessionData
 	pushSessionChan chan *stream.SessionData
 	serverId        string
+	ctx             context.Context
 }
 
 func NewSession(client Client, msg *stream.Msg) *Session {
@@ -123,6 +126,32 @@ func (s *Session) Dispatch(router string, newDst string) {
 	}
 }
 
+// Logger 带上session的uid cid 路由和链路id 在房间中时带上roomId
+func (s *Session) Logger() *logs.Logger {
+	l := logs.With("uid", s.msg.Uid, "cid", s.msg.Cid, "route", s.msg.Router, "traceId", s.msg.TraceId)
+	if roomId, ok := s.Get("roomId"); ok {
+		l = l.With("roomId", roomId)
+	}
+	return l
+}
+
 func (s *Session) GetMsg() *stream.Msg {
 	return s.msg
 }
+
+// GetSerializer 客户端在握手时选择的消息体编码
+func (s *Session) GetSerializer() protocol.Serializer {
+	return protocol.SerializerOrDefault(s.msg.Serializer)
+}
+
+// Context handler处理超时后会被取消 查询数据库等耗时操作使用 避免超时之后继续占用worker
+func (s *Session) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *Session) SetContext(ctx context.Context) {
+	s.ctx = ctx
+}
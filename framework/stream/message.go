@@ -1,6 +1,10 @@
 package stream
 
-import "framework/protocol"
+import (
+	"framework/game"
+	"framework/protocol"
+	"framework/registry"
+)
 
 type Msg struct {
 	Cid         string
@@ -11,8 +15,19 @@ type Msg struct {
 	Uid         string
 	ConnectorId string
 	SessionData *SessionData
-	SessionType SessionType // 0 normal 1 session
+	SessionType SessionType // 0 normal 1 session 2 routeQuery 3 routeAnnounce 4 kick 5 heartbeat 6 serverLeave
 	PushUser    []string
+	Serializer  string              // Body.Data的编码方式 为空时是json
+	Routes      []string            // 节点注册的路由 routeAnnounce时使用
+	Reply       string              // rpc调用的回复地址 不为空时handler的结果发送到此地址
+	Code        int                 // rpc响应码 0为成功
+	ErrMsg      string              // rpc响应的错误信息
+	KickReason  protocol.KickReason // kick时踢下线的原因
+	Server      *game.ServersConfig // heartbeat时节点的配置
+	Load        *registry.Load      // heartbeat时节点的负载
+	Draining    bool                // heartbeat时节点是否在停机排空
+	TraceId     string              // 链路追踪id connector收到客户端请求时生成
+	SpanId      string              // 上游span的id 下游据此挂接子span
 }
 type DataType int
 
@@ -30,4 +45,9 @@ type SessionType int
 const (
 	Normal SessionType = iota
 	Session
+	RouteQuery    // connector启动时向节点查询已注册的路由
+	RouteAnnounce // 节点向connector通告已注册的路由 用于生成路由压缩字典
+	Kick          // 节点通知connector将用户踢下线
+	Heartbeat     // 节点定时广播心跳 connector据此维护存活的节点
+	ServerLeave   // 节点下线
 )
@@ -5,8 +5,9 @@ type PushUser struct {
 	ConnectorId string `json:"connectorId"`
 }
 type PushData struct {
-	Data   []byte `json:"data"`
-	Router string `json:"router"`
+	Data       []byte `json:"data"`
+	Router     string `json:"router"`
+	Serializer string `json:"serializer"`
 }
 
 type PushMessage struct {
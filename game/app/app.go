@@ -1,11 +1,19 @@
 package app
 
 import (
+	"common"
+	"common/biz"
 	"common/config"
 	"common/logs"
+	"common/metrics"
+	"common/trace"
 	"context"
 	"core/repo"
+	"core/service"
 	"framework/node"
+	"framework/remote"
+	"game/handler"
+	"game/logic"
 	"game/route"
 	"os"
 	"os/signal"
@@ -13,21 +21,78 @@ import (
 	"time"
 )
 
+// NewNode 创建注册好路由和中间件的节点 单进程模式也使用
+func NewNode(manager *repo.Manager) *node.App {
+	n := node.Default()
+	um := logic.NewUnionManager()
+	n.RegisterHandler(route.Register(manager, um))
+	//房间数随心跳上报 作为负载均衡的依据
+	n.SetRoomCounter(um.RoomCount)
+	metrics.RegisterGaugeVecFunc("game", "rooms", "当前节点上的房间数", "game_type", func() map[string]float64 {
+		rooms, _ := um.GameStats()
+		return rooms
+	})
+	metrics.RegisterGaugeVecFunc("game", "players", "当前节点上房间中的玩家数 包括旁观", "game_type", func() map[string]float64 {
+		_, players := um.GameStats()
+		return players
+	})
+	//启动时恢复崩溃前的房间
+	redisService := service.NewRedisService(manager)
+	userService := service.NewUserService(manager)
+	unionService := service.NewUnionService(manager)
+	//踢人时根据在线注册表找到用户所在的connector
+	n.SetOnlineLookup(service.NewOnlineService(manager).ConnectorId)
+	n.OnStart(func(session *remote.Session) {
+		um.Restore(session, redisService, userService, unionService)
+		//房间号在redis中占用 房间存在期间定时续期
+		go um.KeepRoomIds(redisService, session.GetServerId(), n.Done())
+		//联盟归属在redis中续期 宕机后由其他游戏服接管
+		go um.KeepUnionOwners(redisService, session.GetServerId(), n.Done())
+		//移除长时间没有访问的联盟
+		go um.SweepIdleUnions(redisService, session.GetServerId(), time.Duration(config.Conf.Union.IdleTime)*time.Second, n.Done())
+	})
+	//hall或其他game节点修改联盟数据后广播 重新加载联盟
+	n.Subscribe(service.UnionChangedSubject)
+	//停机时先释放联盟归属 再等待牌局结束 解散剩余的房间
+	n.OnDrain(func(session *remote.Session, timeout time.Duration) {
+		um.ReleaseUnionOwners(redisService, session.GetServerId())
+	})
+	//滚动发布时先把房间迁移到其他游戏服 玩家不需要重连 迁移失败的房间再等待牌局结束
+	n.OnDrain(func(session *remote.Session, timeout time.Duration) {
+		um.MigrateRooms(session, n.AvailableServers(), timeout/2, redisService)
+	})
+	n.OnDrain(um.Drain)
+	//协程池的运行状态
+	n.RegisterPoolGauges("game")
+	//耗时统计放在最外层 包括其他中间件的耗时
+	n.Use(node.Metrics(metrics.ObserveHandler), node.Recovery(), node.Logger(), node.Auth(common.F(biz.InvalidUsers)))
+	//出牌等操作按用户限流
+	n.UseRoute("gameHandler.", node.RateLimit(20, 40, common.F(biz.RequestTooFrequent)))
+	//联盟请求转发到联盟所在的游戏服 加入房间按房间号转发 联盟变化的广播每个节点都要处理
+	n.UseRoute("unionHandler.", handler.ProxyUnionMiddleware(um, redisService, "unionHandler.joinRoom", "unionHandler.unionChanged"))
+	n.UseRoute("unionMgrHandler.", handler.ProxyUnionMiddleware(um, redisService))
+	return n
+}
+
 func Run(ctx context.Context, serverId string) error {
 	//1.做一个日志库 info error fatal debug
 	logs.InitLog(config.Conf.AppName)
+	shutdownTrace, err := trace.Init(config.Conf.AppName, config.Conf.Trace)
+	if err != nil {
+		logs.Error("init trace err:%v", err)
+		return err
+	}
 	exit := func() {}
 	go func() {
-		n := node.Default()
-		exit = n.Close
-		manager := repo.New()
-		n.RegisterHandler(route.Register(manager))
+		n := NewNode(repo.New())
+		exit = n.Shutdown
 		n.Run(serverId)
 	}()
 	stop := func() {
 		//other
 		exit()
 		time.Sleep(3 * time.Second)
+		shutdownTrace()
 		logs.Info("stop app finish")
 	}
 	//期望有一个优雅启停 遇到中断 退出 终止 挂断
@@ -21,4 +21,6 @@ type RoomFrame interface {
 	GetMaxBureau() int
 	GetHongBaoList() any
 	GetGameStarted() bool
+	// SaveSnapshot 牌局状态变化时保存房间快照
+	SaveSnapshot()
 }
@@ -56,6 +56,8 @@ type GameFrame struct {
 	stopForcePrepareChan    chan struct{}
 	stopScheduleOperateChan chan int
 	stopUserTrustSchedule   chan struct{}
+	saved                   []byte //最近一次序列化的牌局状态
+	savedLock               sync.Mutex
 }
 
 var PlayerCount = 4
@@ -126,6 +128,7 @@ func (g *GameFrame) OnEventRoomDismiss(reason enums.RoomDismissReason, session *
 func (g *GameFrame) OnEventGameStart(user *proto.RoomUser, session *remote.Session) {
 	g.Lock()
 	defer g.Unlock()
+	defer g.capture()
 	g.startGame(session)
 }
 
@@ -143,6 +146,7 @@ func (g *GameFrame) sendDataAll(data any, session *remote.Session) {
 func (g *GameFrame) OnEventUserOffLine(user *proto.RoomUser, session *remote.Session) {
 	g.Lock()
 	defer g.Unlock()
+	defer g.capture()
 	if g.curChairID == user.ChairID {
 		g.offlineUserAutoOperation(user, session)
 	}
@@ -215,30 +219,7 @@ func (g *GameFrame) startGame(session *remote.Session) {
 	}
 	g.gameStarted = true
 	g.trustTmArray = make([]int, PlayerCount)
-	if g.gameRule.CanTrust {
-		if g.userTrustSchedule != nil {
-			go func() {
-				g.stopUserTrustSchedule <- struct{}{}
-			}()
-		}
-		g.userTrustSchedule = tasks.NewTask("userTrustSchedule", time.Second, func() {
-			if g.r.IsDismissing() {
-				return
-			}
-			if g.gameStatus == Playing {
-				for i, v := range g.operateArrays {
-					if v != nil && len(v) > 0 && !g.userTrustArray[i] {
-						g.trustTmArray[i]++
-						if g.trustTmArray[i] > g.trustTm {
-							g.onGameTrust(i, session, MessageData{
-								Trust: true,
-							})
-						}
-					}
-				}
-			}
-		})
-	}
+	g.startTrustSchedule(session)
 	//1 游戏状态 初始状态 推送
 	g.gameStatus = Dices
 	g.tick = GameStatusTmDices
@@ -350,15 +331,57 @@ func (g *GameFrame) sendHandCards(session *remote.Session) {
 	restCardsCount := g.logic.getRestCardsCount()
 	g.sendDataAll(GameRestCardsCountPushData(restCardsCount), session)
 	time.AfterFunc(time.Second, func() {
-		if g.isDismissed {
+		g.startPlaying(session)
+	})
+}
+
+// startPlaying 发牌结束 庄家开始摸牌
+func (g *GameFrame) startPlaying(session *remote.Session) {
+	g.Lock()
+	defer g.Unlock()
+	if g.isDismissed {
+		return
+	}
+	//7. 开始游戏状态推送
+	g.gameStatus = Playing
+	g.tick = 0
+	g.sendDataAll(GameStatusPushData(g.gameStatus, g.tick), session)
+	//玩家的操作时间了
+	g.setTurn(g.bankerChairID, session)
+}
+
+// startTrustSchedule 超时未操作的玩家自动托管
+func (g *GameFrame) startTrustSchedule(session *remote.Session) {
+	if !g.gameRule.CanTrust {
+		return
+	}
+	if g.userTrustSchedule != nil {
+		go func() {
+			g.stopUserTrustSchedule <- struct{}{}
+		}()
+	}
+	g.userTrustSchedule = tasks.NewTask("userTrustSchedule", time.Second, func() {
+		if g.r.IsDismissing() {
 			return
 		}
-		//7. 开始游戏状态推送
-		g.gameStatus = Playing
-		g.tick = 0
-		g.sendDataAll(GameStatusPushData(g.gameStatus, g.tick), session)
-		//玩家的操作时间了
-		g.setTurn(g.bankerChairID, session)
+		var trustChairIDs []int
+		g.Lock()
+		if g.gameStatus == Playing {
+			for i, v := range g.operateArrays {
+				if v != nil && len(v) > 0 && !g.userTrustArray[i] {
+					g.trustTmArray[i]++
+					if g.trustTmArray[i] > g.trustTm {
+						trustChairIDs = append(trustChairIDs, i)
+					}
+				}
+			}
+		}
+		g.Unlock()
+		for _, i := range trustChairIDs {
+			g.onGameTrust(i, session, MessageData{
+				Trust: true,
+			})
+		}
 	})
 }
 
@@ -420,30 +443,39 @@ func (g *GameFrame) setTurn(chairID int, session *remote.Session) {
 			}
 		}
 		g.tick = operateTm1
-		if g.turnSchedule != nil {
-			go func() {
-				g.stopTurnScheduleChan <- struct{}{}
-			}()
-		}
-		g.turnSchedule = tasks.NewTask("turnSchedule", 1*time.Second, func() {
-			if g.r.IsDismissing() {
-				return
-			}
-			g.tick--
-			if g.tick <= 0 {
-				g.userAutoOperate(chairID, 0, session)
-				g.stopTurnScheduleChan <- struct{}{}
-			}
-		})
+		g.startTurnSchedule(chairID, session)
 		//9. 剩余牌数推送
 		restCardsCount := g.logic.getRestCardsCount()
 		g.sendDataAll(GameRestCardsCountPushData(restCardsCount), session)
+		g.saveSnapshot()
 		if g.userTrustArray[chairID] {
 			g.userAutoOperate(chairID, 1, session)
 		}
 	}
 }
 
+// startTurnSchedule 当前玩家的操作倒计时 倒计时结束自动出牌
+func (g *GameFrame) startTurnSchedule(chairID int, session *remote.Session) {
+	if g.turnSchedule != nil {
+		go func() {
+			g.stopTurnScheduleChan <- struct{}{}
+		}()
+	}
+	g.turnSchedule = tasks.NewTask("turnSchedule", 1*time.Second, func() {
+		if g.r.IsDismissing() {
+			return
+		}
+		g.Lock()
+		g.tick--
+		tick := g.tick
+		g.Unlock()
+		if tick <= 0 {
+			g.userAutoOperate(chairID, 0, session)
+			g.stopTurnScheduleChan <- struct{}{}
+		}
+	})
+}
+
 func (g *GameFrame) getMyOperateArray(session *remote.Session, chairID int, card mp.CardID) []OperateType {
 	//需要获取用户可操作的行为 ，比如 弃牌 碰牌 杠牌 胡牌等
 	var operateArray = []OperateType{Qi}
@@ -497,6 +529,8 @@ func (g *GameFrame) onGameChat(user *proto.RoomUser, session *remote.Session, da
 func (g *GameFrame) onGameTurnOperate(chairID int, session *remote.Session, data MessageData, auto bool) {
 	g.Lock()
 	defer g.Unlock()
+	//出牌 碰杠胡都会改变手牌和分数 操作后保存快照
+	defer g.saveSnapshot()
 	if !auto {
 		g.trustTmArray[chairID] = 0
 	}
@@ -710,34 +744,7 @@ func (g *GameFrame) nextTurn(lastCard mp.CardID, session *remote.Session) {
 				user := g.getUserByChairID(i)
 				g.sendData(GameTurnPushData(i, lastCard, operateTm2, operateArray), []string{user.UserInfo.Uid}, session)
 				g.operateArrays[i] = operateArray
-				tick := operateTm2
-				if g.scheduleOperate[i] != nil {
-					logs.Info("nextTurn---111g.scheduleOperate[i]================", i)
-					go func() {
-						g.stopScheduleOperateChan <- i
-					}()
-				}
-				// 创建局部变量来避免闭包捕获循环变量的问题
-				currentChairID := i
-				currentUser := user
-				localTick := tick
-
-				g.scheduleOperate[i] = tasks.NewTask("scheduleOperate", time.Second, func() {
-					if g.r.IsDismissing() {
-						return
-					}
-					localTick--
-					if localTick <= 0 {
-						g.stopScheduleOperateChan <- currentChairID
-						g.sendData(GameTurnOperatePushData(currentChairID, -1, Guo, false), []string{currentUser.UserInfo.Uid}, session)
-						g.operateRecord = append(g.operateRecord, &OperateRecord{currentChairID, nil, Guo})
-
-						g.operateArrays[currentChairID] = nil
-						//倒计时结束 自动出牌 继续下一步
-						nextChairID := (g.curChairID + 1) % chairCount
-						g.setTurn(nextChairID, session)
-					}
-				})
+				g.startOperateSchedule(i, operateTm2, session)
 				if g.userTrustArray[i] {
 					g.userAutoOperate(i, 0, session)
 				}
@@ -750,6 +757,37 @@ func (g *GameFrame) nextTurn(lastCard mp.CardID, session *remote.Session) {
 	}
 }
 
+// startOperateSchedule 其他玩家碰杠胡的操作倒计时 倒计时结束自动过
+func (g *GameFrame) startOperateSchedule(chairID int, tick int, session *remote.Session) {
+	if g.scheduleOperate[chairID] != nil {
+		logs.Info("nextTurn---111g.scheduleOperate[i]================%d", chairID)
+		go func() {
+			g.stopScheduleOperateChan <- chairID
+		}()
+	}
+	user := g.getUserByChairID(chairID)
+	chairCount := g.getChairCount()
+	g.scheduleOperate[chairID] = tasks.NewTask("scheduleOperate", time.Second, func() {
+		if g.r.IsDismissing() {
+			return
+		}
+		tick--
+		if tick <= 0 {
+			g.stopScheduleOperateChan <- chairID
+			g.Lock()
+			defer g.Unlock()
+			g.sendData(GameTurnOperatePushData(chairID, -1, Guo, false), []string{user.UserInfo.Uid}, session)
+			g.operateRecord = append(g.operateRecord, &OperateRecord{chairID, nil, Guo})
+
+			g.operateArrays[chairID] = nil
+			//倒计时结束 自动出牌 继续下一步
+			nextChairID := (g.curChairID + 1) % chairCount
+			g.setTurn(nextChairID, session)
+			g.capture()
+		}
+	})
+}
+
 func (g *GameFrame) gameEnd(session *remote.Session) {
 	g.gameStatus = Result
 	if g.userTrustSchedule != nil {
@@ -960,13 +998,22 @@ func (g *GameFrame) gameEnd(session *remote.Session) {
 	g.resultRecord = append(g.resultRecord, result)
 	g.sendDataAll(GameResultPushData(result), session)
 	g.result = result
+	g.saveSnapshot()
+	g.concludeLater(session)
+	if g.r.GetCurBureau() != g.r.GetMaxBureau() {
+		g.startForcePrepare(forcePrepareTm, session)
+	}
+}
+
+// concludeLater 展示结算后再通知房间结束这一局
+func (g *GameFrame) concludeLater(session *remote.Session) {
 	var endData []*proto.EndData
-	for i := 0; i < chairCount; i++ {
+	for i, score := range g.result.Scores {
 		user := g.getUserByChairID(i)
 		if user != nil {
 			endData = append(endData, &proto.EndData{
 				Uid:   user.UserInfo.Uid,
-				Score: scores[i],
+				Score: score,
 			})
 		}
 	}
@@ -975,37 +1022,46 @@ func (g *GameFrame) gameEnd(session *remote.Session) {
 			return
 		}
 		g.r.ConcludeGame(endData, session)
+		g.Lock()
+		defer g.Unlock()
 		g.resetGame(session)
 	})
-	tick := 33
-	if g.r.GetCurBureau() != g.r.GetMaxBureau() {
-		if g.forcePrepareID != nil {
-			go func() {
-				g.stopForcePrepareChan <- struct{}{}
-			}()
+}
+
+// startForcePrepare 小局结束后倒计时 结束时自动准备
+func (g *GameFrame) startForcePrepare(tick int, session *remote.Session) {
+	if g.forcePrepareID != nil {
+		go func() {
+			g.stopForcePrepareChan <- struct{}{}
+		}()
+	}
+	g.forcePrepareID = tasks.NewTask("forcePrepareID", 1*time.Second, func() {
+		if g.r.IsDismissing() {
+			return
 		}
-		g.forcePrepareID = tasks.NewTask("forcePrepareID", 1*time.Second, func() {
-			if g.r.IsDismissing() {
-				return
-			}
-			tick--
-			if tick <= 0 {
-				if g.gameStatus == GameStatusNone {
-					for _, user := range g.r.GetUsers() {
-						if user.UserStatus&enums.Ready > 0 {
-							//手动准备过，倒计时清零
-							g.trustTmArray[user.ChairID] = 0
-						}
-						if user.UserStatus&enums.Ready == 0 &&
-							g.gameStatus == GameStatusNone && !g.r.GetGameStarted() {
-							g.r.UserReady(user.UserInfo.Uid, session)
-						}
+		tick--
+		if tick <= 0 {
+			var readyUids []string
+			g.Lock()
+			if g.gameStatus == GameStatusNone {
+				for _, user := range g.r.GetUsers() {
+					if user.UserStatus&enums.Ready > 0 {
+						//手动准备过，倒计时清零
+						g.trustTmArray[user.ChairID] = 0
+					}
+					if user.UserStatus&enums.Ready == 0 && !g.r.GetGameStarted() {
+						readyUids = append(readyUids, user.UserInfo.Uid)
 					}
 				}
-				g.stopForcePrepareChan <- struct{}{}
 			}
-		})
-	}
+			g.Unlock()
+			//准备后可能开始游戏 需要在释放牌局锁之后调用
+			for _, uid := range readyUids {
+				g.r.UserReady(uid, session)
+			}
+			g.stopForcePrepareChan <- struct{}{}
+		}
+	})
 }
 
 func (g *GameFrame) resetGame(session *remote.Session) {
@@ -1023,11 +1079,13 @@ func (g *GameFrame) resetGame(session *remote.Session) {
 	g.operateRecord = make([]*OperateRecord, 0)
 	g.handCards = make([][]mp.CardID, PlayerCount)
 	g.result = nil
+	g.saveSnapshot()
 }
 
 func (g *GameFrame) onGetCard(chairID int, session *remote.Session, data MessageData) {
 	g.Lock()
 	defer g.Unlock()
+	defer g.capture()
 	g.testCardArray[chairID] = data.Card
 }
 
@@ -1037,24 +1095,30 @@ func (g *GameFrame) userAutoOperate(chairID int, delayTime int, session *remote.
 	}
 	g.userAutoOperateSch = time.AfterFunc(time.Duration(delayTime)*time.Second, func() {
 		if !g.isDismissed {
+			//读取操作列表时加锁 自动操作和准备在释放锁之后调用
+			var operate *MessageData
+			g.Lock()
 			operateArray := g.operateArrays[chairID]
 			if len(operateArray) > 0 {
-				if IndexOf(operateArray, Qi) != -1 {
-					g.onGameTurnOperate(chairID,
-						session,
-						MessageData{
-							Operate: Qi,
-							Card:    g.handCards[chairID][len(g.handCards[chairID])-1],
-						}, true)
+				if IndexOf(operateArray, Qi) != -1 && len(g.handCards[chairID]) > 0 {
+					operate = &MessageData{
+						Operate: Qi,
+						Card:    g.handCards[chairID][len(g.handCards[chairID])-1],
+					}
 				} else if IndexOf(operateArray, Guo) != -1 {
-					g.onGameTurnOperate(chairID,
-						session,
-						MessageData{
-							Operate: Guo,
-						}, true)
+					operate = &MessageData{
+						Operate: Guo,
+					}
 				}
 			}
-			if g.gameStatus == GameStatusNone {
+			g.Unlock()
+			if operate != nil {
+				g.onGameTurnOperate(chairID, session, *operate, true)
+			}
+			g.RLock()
+			gameStatus := g.gameStatus
+			g.RUnlock()
+			if gameStatus == GameStatusNone {
 				user := g.getUserByChairID(chairID)
 				if user != nil && (user.UserStatus&enums.Ready) == 0 {
 					g.r.UserReady(user.UserInfo.Uid, session)
@@ -1067,6 +1131,7 @@ func (g *GameFrame) userAutoOperate(chairID int, delayTime int, session *remote.
 func (g *GameFrame) onGameTrust(chairID int, session *remote.Session, data MessageData) {
 	g.Lock()
 	defer g.Unlock()
+	defer g.capture()
 	g.trustTmArray[chairID] = 0
 	g.userTrustArray[chairID] = data.Trust
 	uid := g.getUserByChairID(chairID).Uid
@@ -88,8 +88,9 @@ type BureauReview struct {
 	IsBanker bool   `json:"isBanker"`
 }
 
-const operateTm1 = 30 // 弃牌操作时间
-const operateTm2 = 30 //  碰杠操作时间
+const operateTm1 = 30     // 弃牌操作时间
+const operateTm2 = 30     //  碰杠操作时间
+const forcePrepareTm = 33 // 小局结束后自动准备的时间
 
 type OperateType int
 
@@ -0,0 +1,185 @@
+package mj
+
+import (
+	"common/logs"
+	"common/tasks"
+	"encoding/json"
+	"framework/remote"
+	"game/component/mj/mp"
+	"time"
+)
+
+// snapshot 牌局中需要持久化的状态 定时器在恢复时根据游戏状态重新启动
+type snapshot struct {
+	GameStatus     GameStatus                `json:"gameStatus"`
+	GameStarted    bool                      `json:"gameStarted"`
+	Tick           int                       `json:"tick"`
+	CurChairID     int                       `json:"curChairID"`
+	GangChairID    int                       `json:"gangChairID"`
+	BankerChairID  int                       `json:"bankerChairID"`
+	UserTrustArray []bool                    `json:"userTrustArray"`
+	TrustTmArray   []int                     `json:"trustTmArray"`
+	TestCardArray  []mp.CardID               `json:"testCardArray"`
+	UserWinRecord  map[string]*UserWinRecord `json:"userWinRecord"`
+	ReviewRecord   []*ReviewRecord           `json:"reviewRecord"`
+	ResultRecord   []*GameResult             `json:"resultRecord"`
+	ScoreRecord    []int                     `json:"scoreRecord"`
+	HuRecord       []int                     `json:"huRecord"`
+	GongGangRecord []int                     `json:"gongGangRecord"`
+	AnGangRecord   []int                     `json:"anGangRecord"`
+	MaRecord       []int                     `json:"maRecord"`
+	OperateRecord  []*OperateRecord          `json:"operateRecord"`
+	OperateArrays  [][]OperateType           `json:"operateArrays"`
+	HandCards      [][]mp.CardID             `json:"handCards"`
+	Result         *GameResult               `json:"result"`
+	UserRecord     []*UserRecord             `json:"userRecord"`
+	Cards          []mp.CardID               `json:"cards"`
+}
+
+// Snapshot 返回最近一次保存的牌局状态 房间在不确定是否持有牌局锁的地方调用 所以这里不加牌局锁
+func (g *GameFrame) Snapshot() ([]byte, error) {
+	g.savedLock.Lock()
+	defer g.savedLock.Unlock()
+	return g.saved, nil
+}
+
+// capture 序列化牌局状态 需要持有牌局锁 状态变化的流程在释放锁之前调用
+func (g *GameFrame) capture() {
+	g.logic.RLock()
+	cards := append([]mp.CardID{}, g.logic.cards...)
+	g.logic.RUnlock()
+	data, err := json.Marshal(&snapshot{
+		GameStatus:     g.gameStatus,
+		GameStarted:    g.gameStarted,
+		Tick:           g.tick,
+		CurChairID:     g.curChairID,
+		GangChairID:    g.gangChairID,
+		BankerChairID:  g.bankerChairID,
+		UserTrustArray: g.userTrustArray,
+		TrustTmArray:   g.trustTmArray,
+		TestCardArray:  g.testCardArray,
+		UserWinRecord:  g.userWinRecord,
+		ReviewRecord:   g.reviewRecord,
+		ResultRecord:   g.resultRecord,
+		ScoreRecord:    g.scoreRecord,
+		HuRecord:       g.huRecord,
+		GongGangRecord: g.gongGangRecord,
+		AnGangRecord:   g.anGangRecord,
+		MaRecord:       g.maRecord,
+		OperateRecord:  g.operateRecord,
+		OperateArrays:  g.operateArrays,
+		HandCards:      g.handCards,
+		Result:         g.result,
+		UserRecord:     g.userRecord,
+		Cards:          cards,
+	})
+	if err != nil {
+		logs.Error("mj capture snapshot err:%v, roomId=%s", err, g.r.GetId())
+		return
+	}
+	g.savedLock.Lock()
+	g.saved = data
+	g.savedLock.Unlock()
+}
+
+// saveSnapshot 持有牌局锁时保存快照
+func (g *GameFrame) saveSnapshot() {
+	g.capture()
+	g.r.SaveSnapshot()
+}
+
+// Restore 从快照恢复牌局 并按当前的游戏状态重新启动定时器
+func (g *GameFrame) Restore(data []byte, session *remote.Session) error {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	g.Lock()
+	defer g.Unlock()
+	g.gameStatus = s.GameStatus
+	g.gameStarted = s.GameStarted
+	g.tick = s.Tick
+	g.curChairID = s.CurChairID
+	g.gangChairID = s.GangChairID
+	g.bankerChairID = s.BankerChairID
+	g.userTrustArray = s.UserTrustArray
+	g.trustTmArray = s.TrustTmArray
+	g.testCardArray = s.TestCardArray
+	g.userWinRecord = s.UserWinRecord
+	g.reviewRecord = s.ReviewRecord
+	g.resultRecord = s.ResultRecord
+	g.scoreRecord = s.ScoreRecord
+	g.huRecord = s.HuRecord
+	g.gongGangRecord = s.GongGangRecord
+	g.anGangRecord = s.AnGangRecord
+	g.maRecord = s.MaRecord
+	g.operateRecord = s.OperateRecord
+	g.operateArrays = s.OperateArrays
+	g.handCards = s.HandCards
+	g.result = s.Result
+	g.userRecord = s.UserRecord
+	g.logic.Lock()
+	g.logic.cards = s.Cards
+	g.logic.Unlock()
+	g.rearmSchedules(session)
+	g.capture()
+	return nil
+}
+
+func (g *GameFrame) rearmSchedules(session *remote.Session) {
+	if g.r.GetGameStarted() {
+		g.startTrustSchedule(session)
+	}
+	switch g.gameStatus {
+	case Dices:
+		//发牌后等待开始的时间很短 直接进入摸牌
+		time.AfterFunc(time.Second, func() {
+			g.startPlaying(session)
+		})
+	case Playing:
+		for i, v := range g.operateArrays {
+			if len(v) == 0 {
+				continue
+			}
+			if i == g.curChairID {
+				//倒计时从快照中的剩余时间继续
+				g.startTurnSchedule(i, session)
+			} else {
+				g.startOperateSchedule(i, operateTm2, session)
+			}
+			if g.userTrustArray[i] {
+				g.userAutoOperate(i, 1, session)
+			}
+		}
+	case Result:
+		if g.result != nil {
+			g.concludeLater(session)
+		}
+		if g.r.GetCurBureau() != g.r.GetMaxBureau() {
+			g.startForcePrepare(forcePrepareTm, session)
+		}
+	default:
+		if g.r.GetCurBureau() > 0 && !g.r.GetGameStarted() && g.r.GetCurBureau() != g.r.GetMaxBureau() {
+			g.startForcePrepare(forcePrepareTm, session)
+		}
+	}
+}
+
+// StopSchedules 停止牌局的所有定时器 房间迁移到其他游戏服后由新的游戏服继续
+// 没有保存引用的延时任务通过isDismissed跳过
+func (g *GameFrame) StopSchedules() {
+	g.isDismissed = true
+	if g.userAutoOperateSch != nil {
+		g.userAutoOperateSch.Stop()
+	}
+	for _, v := range g.scheduleOperate {
+		if v != nil {
+			v.Stop()
+		}
+	}
+	for _, v := range []*tasks.Task{g.turnSchedule, g.userTrustSchedule, g.forcePrepareID} {
+		if v != nil {
+			v.Stop()
+		}
+	}
+}
@@ -133,6 +133,16 @@ func UserOffLinePushData(chairId int) any {
 	}
 	return pushMsg
 }
+func UserReconnectPushData(chairId int) any {
+	pushMsg := map[string]any{
+		"type": UserReconnectPush,
+		"data": map[string]any{
+			"chairID": chairId,
+		},
+		"pushRouter": "RoomMessagePush",
+	}
+	return pushMsg
+}
 func UpdateUserInfoPush(pushMsg map[string]any) any {
 	//pushMsg := map[string]any{
 	//	"roomID":     roomId,
@@ -0,0 +1,68 @@
+package room
+
+import (
+	"bytes"
+	"context"
+	"core/dao"
+	"encoding/json"
+)
+
+// UpdateDirectory 更新联盟房间目录 其他游戏服据此展示房间列表和快速加入
+func (r *Room) UpdateDirectory() {
+	if r.roomDismissed || r.migrating || r.RedisService == nil {
+		return
+	}
+	r.stateLock.Lock()
+	entry := r.directoryEntry()
+	r.stateLock.Unlock()
+	if entry != nil {
+		r.queueSnapshot(&snapshotTask{directory: entry})
+	}
+}
+
+// directoryEntry 需要持有stateLock
+func (r *Room) directoryEntry() *dao.UnionRoom {
+	info, err := json.Marshal(r.GetRoomInfo())
+	if err != nil {
+		r.logger().Error("room UpdateDirectory marshal err:%v", err)
+		return nil
+	}
+	entry := &dao.UnionRoom{
+		RoomId:     r.Id,
+		RuleId:     r.GameRule.Id,
+		MaxPlayers: r.chairCount,
+		Started:    r.gameStarted,
+		Joinable:   r.CanEnter() && r.HasEmptyChair(),
+		ServerId:   r.serverId,
+		Info:       info,
+	}
+	for _, v := range r.users {
+		if v.ChairID >= 0 && v.ChairID < r.chairCount {
+			entry.Seated++
+		}
+	}
+	return entry
+}
+
+// writeDirectory 在写协程中调用 和上次写入的数据相同时跳过
+func (r *Room) writeDirectory(entry *dao.UnionRoom) {
+	data, _ := json.Marshal(entry)
+	if bytes.Equal(data, r.directory) {
+		return
+	}
+	err := r.RedisService.SaveUnionRoom(context.Background(), r.unionID, entry)
+	if err != nil {
+		r.logger().Error("room UpdateDirectory err:%v", err)
+		return
+	}
+	r.directory = data
+}
+
+// deleteDirectory 在写协程中调用
+func (r *Room) deleteDirectory() {
+	r.directory = nil
+	err := r.RedisService.DeleteUnionRoom(context.Background(), r.unionID, r.Id)
+	if err != nil {
+		r.logger().Error("room deleteDirectory err:%v", err)
+	}
+}
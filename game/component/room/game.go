@@ -20,6 +20,12 @@ type GameFrame interface {
 	OnEventRoomDismiss(reason enums.RoomDismissReason, session *remote.Session)
 	GetGameVideoData() any
 	GetGameBureauData() any
+	// Snapshot 序列化牌局状态 用于崩溃恢复
+	Snapshot() ([]byte, error)
+	// Restore 从快照恢复牌局状态 并重新启动定时器
+	Restore(data []byte, session *remote.Session) error
+	// StopSchedules 停止牌局的所有定时器 房间迁移到其他游戏服时调用
+	StopSchedules()
 }
 
 func NewGameFrame(rule proto.GameRule, r base.RoomFrame, session *remote.Session) (GameFrame, error) {
@@ -3,6 +3,7 @@ package room
 import (
 	"common/biz"
 	"common/logs"
+	"common/metrics"
 	"common/tasks"
 	"common/utils"
 	"context"
@@ -61,6 +62,7 @@ type Room struct {
 	hasFinishedOneBureau   bool
 	hasStartedOneBureau    bool
 	alreadyCostUserUidArr  []string
+	rentCharged            map[string]int //首局开始时实际收取的房费 没有完成一局就解散时按此退还
 	userJoinGameBureau     map[string]int //记录玩家从第几局加入游戏
 	maxBureau              int            //最大局数
 	curBureau              int            //当前局数
@@ -71,6 +73,17 @@ type Room struct {
 	stopStartSchedulerID   chan struct{}
 	resultLotteryInfo      *entity.ResultLotteryInfo
 	userGetHongBaoCountArr []int
+	serverId               string //房间所在的游戏服 快照按游戏服保存
+	migrating              bool   //正在迁移到其他游戏服
+	directory              []byte //最近一次写入联盟房间目录的数据 没有变化时不重复写入 只在写协程中访问
+	closed                 chan struct{}
+	closeOnce              sync.Once
+	stateLock              sync.Mutex    //房间状态的写入和快照序列化时加锁 房间锁用TryLock 不能保证互斥 持有时不能调用其他方法
+	pending                *snapshotTask //等待写协程写入的快照
+	pendingLock            sync.Mutex
+	snapshotSignal         chan struct{}
+	writerOnce             sync.Once
+	writeLock              sync.Mutex //写入快照和目录时持有 冻结时等待正在进行的写入结束
 }
 
 func (r *Room) GetGameStarted() bool {
@@ -82,6 +95,8 @@ func (r *Room) GetMaxBureau() int {
 }
 
 func (r *Room) SetCurBureau(curBureau int) {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
 	r.curBureau = curBureau
 }
 
@@ -103,17 +118,20 @@ func (r *Room) ConcludeGame(data []*proto.EndData, session *remote.Session) {
 	if !r.gameStarted {
 		return
 	}
+	r.stateLock.Lock()
 	r.gameStarted = false
 	r.hasFinishedOneBureau = true
 	for _, v := range r.users {
 		v.UserStatus &= ^enums.Playing
 		v.UserStatus &= ^enums.Ready
 	}
+	r.stateLock.Unlock()
 	//记录游戏结果
 	r.recordGameResult(data, session)
 	//收取固定抽分
 	r.calculateRebateWhenStart(session)
 	//记录已经付房费的玩家，防止重复
+	r.stateLock.Lock()
 	for _, v := range r.users {
 		if v.ChairID >= r.chairCount {
 			continue
@@ -123,6 +141,7 @@ func (r *Room) ConcludeGame(data []*proto.EndData, session *remote.Session) {
 		}
 		r.alreadyCostUserUidArr = append(r.alreadyCostUserUidArr, v.UserInfo.Uid)
 	}
+	r.stateLock.Unlock()
 	// 收取每小局分数
 	r.recordOneDrawResult(data, session)
 	// 判断房间是否应该解散
@@ -136,8 +155,10 @@ func (r *Room) ConcludeGame(data []*proto.EndData, session *remote.Session) {
 		// 通知更新所有玩家信息
 		r.notifyUpdateAllUserInfo(session)
 	}
+	r.SaveSnapshot()
 }
 func (r *Room) resetRoom(session *remote.Session) error {
+	r.stateLock.Lock()
 	r.createTime = time.Now()
 	r.lastNativeTime = time.Now()
 	r.roomDismissed = false
@@ -149,15 +170,20 @@ func (r *Room) resetRoom(session *remote.Session) error {
 	for _, v := range r.users {
 		v.WinScore = 0
 	}
+	r.stateLock.Unlock()
+	//牌局初始化时会保存快照 不能持有stateLock
+	gameFrame, err := NewGameFrame(r.GameRule, r, session)
+	r.stateLock.Lock()
 	r.clearUserArr = make(map[string]*entity.GameUser)
-	var err error
-	r.GameFrame, err = NewGameFrame(r.GameRule, r, session)
+	r.GameFrame = gameFrame
+	r.stateLock.Unlock()
 	if err != nil {
 		return err
 	}
 	for _, v := range r.users {
 		go r.addKickScheduleEvent(session, v.Uid)
 	}
+	r.SaveSnapshot()
 	return nil
 }
 func (r *Room) UserReady(uid string, session *remote.Session) {
@@ -165,6 +191,8 @@ func (r *Room) UserReady(uid string, session *remote.Session) {
 }
 
 func (r *Room) EndGame(session *remote.Session) {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
 	r.gameStarted = false
 	for k := range r.users {
 		r.users[k].UserStatus = enums.UserStatusNone
@@ -207,18 +235,22 @@ func (r *Room) UserEntryRoom(
 			ChairID:    chairID,
 			UserStatus: enums.UserStatusNone,
 		}
+		r.stateLock.Lock()
 		r.users[data.Uid] = user
 		r.currentUserCount++
+		r.stateLock.Unlock()
 		//2. 将房间号 推送给客户端 更新数据库 当前房间号存储起来
 		err := r.UpdateUserInfoRoomPush(session, data.Uid)
 		if err != nil {
 			return biz.SqlError
 		}
 	} else {
+		r.stateLock.Lock()
 		user.UserInfo = userInfo
 		if user.UserStatus&enums.Offline > 0 {
 			user.UserStatus &= ^enums.Offline
 		}
+		r.stateLock.Unlock()
 		//如果有离线倒计时，这里应该取消
 	}
 	session.Put("roomId", r.Id, stream.Single)
@@ -239,6 +271,7 @@ func (r *Room) UserEntryRoom(
 	r.SelfEntryRoomPush(session, data.Uid)
 	r.GameFrame.OnEventUserEntry(user, session)
 	go r.addKickScheduleEvent(session, userInfo.Uid)
+	r.SaveSnapshot()
 	return nil
 }
 
@@ -287,6 +320,29 @@ func (r *Room) ReceiveRoomMessage(session *remote.Session, req request.RoomMessa
 	if req.Type == proto.UserChatNotify {
 		r.userChat(session, req.Data)
 	}
+	if req.Type == proto.UserReconnectNotify {
+		r.userReconnect(session)
+	}
+}
+
+// userReconnect 用户断线重连或在其他connector重新登录 后续推送发往新的connector 并重发房间和游戏数据
+func (r *Room) userReconnect(session *remote.Session) {
+	user, ok := r.users[session.GetUid()]
+	if !ok {
+		return
+	}
+	r.stateLock.Lock()
+	user.UserInfo.FrontendId = session.GetMsg().ConnectorId
+	if user.UserStatus&enums.Offline > 0 {
+		user.UserStatus &= ^enums.Offline
+	}
+	r.stateLock.Unlock()
+	//恢复后的推送需要发往新的connector
+	r.SaveSnapshot()
+	if r.roomType != Hundred {
+		r.sendData(proto.UserReconnectPushData(user.ChairID), session.GetMsg())
+	}
+	r.getRoomSceneInfoPush(session)
 }
 
 func (r *Room) getRoomSceneInfoPush(session *remote.Session) {
@@ -338,6 +394,7 @@ func (r *Room) addKickScheduleEvent(session *remote.Session, uid string) {
 			if r.efficacyDismissRoom() {
 				r.DismissRoom(session, enums.DismissNone)
 			}
+			r.SaveSnapshot()
 		}
 		_, ok1 := r.kickSchedules[roomUser.UserInfo.Uid]
 		if ok1 {
@@ -357,8 +414,10 @@ func (r *Room) kickUser(user *proto.RoomUser, session *remote.Session) {
 	r.userLeaveRoomNotify([]*proto.RoomUser{user}, session)
 	//通知其他人用户离开房间
 	r.sendData(proto.UserLeaveRoomPushData(user), session.GetMsg())
+	r.stateLock.Lock()
 	delete(r.users, user.UserInfo.Uid)
 	r.currentUserCount--
+	r.stateLock.Unlock()
 	//关于此用户的定时器停止
 	_, ok := r.kickSchedules[user.UserInfo.Uid]
 	if ok {
@@ -376,6 +435,7 @@ func (r *Room) DismissRoom(session *remote.Session, reason enums.RoomDismissReas
 	r.roomDismissed = true
 	//将redis中房间信息删除掉
 	r.RedisService.Delete(r.Id)
+	r.deleteSnapshot()
 	//解散 将union当中存储的room信息 删除掉
 	r.cancelAllScheduler()
 	r.createHongBaoList()
@@ -384,6 +444,7 @@ func (r *Room) DismissRoom(session *remote.Session, reason enums.RoomDismissReas
 	//获取并存储房间的数据
 	if r.currentUserCount == 0 ||
 		reason == enums.UnionOwnerDismiss ||
+		reason == enums.ServerDismiss ||
 		r.RoomCreator.CreatorType == enums.UserCreatorType ||
 		(reason == enums.UserDismiss && !r.hasFinishedOneBureau) {
 		var users []*proto.RoomUser
@@ -409,6 +470,19 @@ func (r *Room) DismissRoom(session *remote.Session, reason enums.RoomDismissReas
 	}
 }
 
+// DismissForShutdown 服务器停机时解散房间 没有完成过一局时退还已收取的房费
+func (r *Room) DismissForShutdown(session *remote.Session) {
+	r.Lock()
+	defer r.Unlock()
+	if r.roomDismissed {
+		return
+	}
+	if r.maxBureau > 0 && r.hasStartedOneBureau && !r.hasFinishedOneBureau {
+		r.refundRoomRent(session)
+	}
+	r.DismissRoom(session, enums.ServerDismiss)
+}
+
 func (r *Room) cancelAllScheduler() {
 	if r.answerExitSchedule != nil {
 		r.stopAnswerSchedules <- struct{}{}
@@ -438,12 +512,14 @@ func (r *Room) userReady(uid string, session *remote.Session) {
 		r.kickUser(user, session)
 		return
 	}
-	if user.UserStatus&enums.Ready == 0 {
-		user.UserStatus |= enums.Ready
-		user.UserStatus |= enums.Dismiss
-	} else {
+	if user.UserStatus&enums.Ready != 0 {
 		return
 	}
+	r.stateLock.Lock()
+	user.UserStatus |= enums.Ready
+	user.UserStatus |= enums.Dismiss
+	r.stateLock.Unlock()
+	r.SaveSnapshot()
 	r.sendData(proto.UserReadyPushData(user.ChairID), session.GetMsg())
 	efficacyStartRoom := r.efficacyStartRoom()
 	if efficacyStartRoom {
@@ -584,7 +660,8 @@ func (r *Room) startGame(session *remote.Session, user *proto.RoomUser) {
 		}
 		err := r.collectionRoomRentWhenStart(session)
 		if err != nil {
-			logs.Error("collectionRoomRentWhenStart err=%v", err)
+			r.logger().Error("collectionRoomRentWhenStart err:%v", err)
+			r.settlementFailed("rent")
 			newError := msError.NewError(-1, errors.New("扣取房费失败，房间已解散"))
 			r.sendPopDialogContent(newError, r.getUids(), session)
 			r.DismissRoom(session, enums.UnionOwnerDismiss)
@@ -594,14 +671,12 @@ func (r *Room) startGame(session *remote.Session, user *proto.RoomUser) {
 				continue
 			}
 			// 记录加入游戏的局数
-			value, ok := r.userJoinGameBureau[v.UserInfo.Uid]
-			if ok {
-				r.userJoinGameBureau[v.UserInfo.Uid] = value + 1
-			} else {
-				r.userJoinGameBureau[v.UserInfo.Uid] = 1
-			}
+			r.stateLock.Lock()
+			r.userJoinGameBureau[v.UserInfo.Uid]++
+			r.stateLock.Unlock()
 		}
 	}
+	r.stateLock.Lock()
 	r.lastNativeTime = time.Now()
 	r.hasStartedOneBureau = true
 	r.gameStarted = true
@@ -611,7 +686,9 @@ func (r *Room) startGame(session *remote.Session, user *proto.RoomUser) {
 			v.UserStatus |= enums.Playing
 		}
 	}
+	r.stateLock.Unlock()
 	r.GameFrame.OnEventGameStart(user, session)
+	r.SaveSnapshot()
 }
 
 func NewRoom(roomId string, creatorInfo *proto.RoomCreator, rule proto.GameRule, u base.UnionBase, session *remote.Session) (*Room, error) {
@@ -627,8 +704,11 @@ func NewRoom(roomId string, creatorInfo *proto.RoomCreator, rule proto.GameRule,
 		maxBureau:              utils.Default(rule.Bureau, 8),
 		stopAnswerSchedules:    make(chan struct{}, 1),
 		stopStartSchedulerID:   make(chan struct{}, 1),
+		closed:                 make(chan struct{}),
+		snapshotSignal:         make(chan struct{}, 1),
 		userJoinGameBureau:     make(map[string]int),
 		userGetHongBaoCountArr: make([]int, 0),
+		serverId:               session.GetServerId(),
 	}
 	r.RoomCreator = creatorInfo
 	var err error
@@ -642,12 +722,22 @@ func NewRoom(roomId string, creatorInfo *proto.RoomCreator, rule proto.GameRule,
 func (r *Room) GetHongBaoList() any {
 	return r.userGetHongBaoCountArr
 }
+
+// UserCount 房间中的玩家数 包括旁观
+func (r *Room) UserCount() int {
+	return r.currentUserCount
+}
+
 func (r *Room) GetUsers() map[string]*proto.RoomUser {
 	return r.users
 }
 func (r *Room) GetId() string {
 	return r.Id
 }
+
+func (r *Room) GetServerId() string {
+	return r.serverId
+}
 func (r *Room) GameMessageHandle(session *remote.Session, msg []byte) {
 	//需要游戏去处理具体的消息
 	user, ok := r.users[session.GetUid()]
@@ -782,7 +872,9 @@ func (r *Room) userChangeSeat(session *remote.Session, fromChairID int, toChairI
 	}
 	if !r.gameStarted && user.UserStatus == enums.Ready {
 		//如果游戏未开始，且玩家已准备，则重置用户状态
+		r.stateLock.Lock()
 		user.UserStatus = enums.UserStatusNone
+		r.stateLock.Unlock()
 	}
 	//目标位置有人 不能换座位
 	if r.getUserByChairID(toChairID) != nil {
@@ -792,7 +884,10 @@ func (r *Room) userChangeSeat(session *remote.Session, fromChairID int, toChairI
 	if toChairID < r.chairCount && user.UserInfo.Score < r.GameRule.ScoreLowLimit {
 		return
 	}
+	r.stateLock.Lock()
 	user.ChairID = toChairID
+	r.stateLock.Unlock()
+	r.SaveSnapshot()
 	//推送给所有用户
 	r.sendData(proto.GetUserChangeSeatPush(fromChairID, toChairID, user.UserInfo.Uid), session.GetMsg())
 }
@@ -821,7 +916,9 @@ func (r *Room) userLeaveRoom(session *remote.Session) {
 			r.kickUser(user, session)
 		} else {
 			//离线了
+			r.stateLock.Lock()
 			user.UserStatus |= enums.Offline
+			r.stateLock.Unlock()
 			if r.roomType != Hundred {
 				r.sendData(proto.UserOffLinePushData(user.ChairID), session.GetMsg())
 			}
@@ -837,6 +934,7 @@ func (r *Room) userLeaveRoom(session *remote.Session) {
 	if r.efficacyDismissRoom() {
 		r.DismissRoom(session, enums.DismissNone)
 	}
+	r.SaveSnapshot()
 }
 
 func (r *Room) efficacyDismissRoom() bool {
@@ -863,7 +961,7 @@ func (r *Room) userLeaveRoomNotify(users []*proto.RoomUser, session *remote.Sess
 	for _, user := range users {
 		err := r.UserService.UpdateUserRoomId(context.Background(), user.UserInfo.Uid, "")
 		if err != nil {
-			logs.Error("UpdateUserRoomId err : %v", err)
+			r.logger().With("uid", user.UserInfo.Uid).Error("UpdateUserRoomId err:%v", err)
 			return
 		}
 		session.Put("roomId", "", stream.Single)
@@ -921,6 +1019,9 @@ func (r *Room) isDismissing() bool {
 }
 
 func (r *Room) CanEnter() bool {
+	if r.migrating {
+		return false
+	}
 	hasEmpty := r.HasEmptyChair()
 	canWatch := r.GameRule.CanWatch
 	canEnter := r.GameRule.CanEnter && (r.GameRule.GameType != enums.PDK)
@@ -1004,6 +1105,8 @@ func (r *Room) recordGameResult(dataArr []*proto.EndData, session *remote.Sessio
 			updateUser := r.UserService.UpdateUserDataScoreInc(v.Uid, r.RoomCreator.UnionID, v.Score)
 			if updateUser != nil {
 				updateUserArr = append(updateUserArr, updateUser)
+			} else {
+				r.settlementFailed("score")
 			}
 		} else {
 			userInfo := &proto.UserInfo{
@@ -1012,7 +1115,9 @@ func (r *Room) recordGameResult(dataArr []*proto.EndData, session *remote.Sessio
 			}
 			r.updateRoomUserInfo(userInfo, false, session)
 		}
+		r.stateLock.Lock()
 		user.WinScore = user.WinScore + v.Score
+		r.stateLock.Unlock()
 	}
 	if len(updateUserArr) > 0 {
 		var scoreChangeRecordArr []*entity.UserScoreChangeRecord
@@ -1060,16 +1165,29 @@ func (r *Room) recordGameResult(dataArr []*proto.EndData, session *remote.Sessio
 			})
 		}
 		if len(scoreChangeRecordArr) > 0 {
-			_ = r.UserService.SaveUserScoreChangeRecordList(scoreChangeRecordArr)
+			if err := r.UserService.SaveUserScoreChangeRecordList(scoreChangeRecordArr); err != nil {
+				r.settlementFailed("record")
+			}
 		}
 	}
 }
 
+// logger 房间的日志 带上roomId 级别可以在log.modules.room中设置
+func (r *Room) logger() *logs.Logger {
+	return logs.Module("room").With("roomId", r.Id)
+}
+
+// settlementFailed 记录结算失败 stage是失败的环节
+func (r *Room) settlementFailed(stage string) {
+	metrics.SettlementFailures.WithLabelValues(strconv.Itoa(int(r.GameRule.GameType)), stage).Inc()
+}
+
 func (r *Room) updateRoomUserInfo(userInfo *proto.UserInfo, notify bool, session *remote.Session) {
 	user, ok := r.users[userInfo.Uid]
 	if !ok {
 		return
 	}
+	r.stateLock.Lock()
 	if userInfo.Score > 0 {
 		user.UserInfo.Score = userInfo.Score
 	}
@@ -1079,6 +1197,7 @@ func (r *Room) updateRoomUserInfo(userInfo *proto.UserInfo, notify bool, session
 	if userInfo.Gold > 0 {
 		user.UserInfo.Gold = userInfo.Gold
 	}
+	r.stateLock.Unlock()
 	if notify {
 		r.sendData(proto.UserInfoChangePushData(user.UserInfo), session.GetMsg())
 	}
@@ -1204,7 +1323,7 @@ func (r *Room) execRebate(unionID int64, roomId string, gameType enums.GameType,
 	}
 	userData, err := r.UserService.FindUserByUid(context.TODO(), spreaderID)
 	if err != nil {
-		logs.Error("FindUserByUid err : %v", err)
+		r.logger().With("uid", spreaderID).Error("FindUserByUid err:%v", err)
 		return
 	}
 	var unionInfo *entity.UnionInfo
@@ -1350,6 +1469,7 @@ func (r *Room) clearNonSatisfiedConditionsUser(session *remote.Session) {
 					kickUidArr = append(kickUidArr, user.UserInfo.Uid)
 					kickChairIDArr = append(kickChairIDArr, user.ChairID)
 				}
+				r.stateLock.Lock()
 				_, ok := r.clearUserArr[user.UserInfo.Uid]
 				if ok {
 					r.clearUserArr[user.UserInfo.Uid].WinScore += user.WinScore
@@ -1362,6 +1482,7 @@ func (r *Room) clearNonSatisfiedConditionsUser(session *remote.Session) {
 						SpreaderID: user.UserInfo.SpreaderID,
 					}
 				}
+				r.stateLock.Unlock()
 			}
 		}
 	}
@@ -1444,11 +1565,19 @@ func (r *Room) stopSchedule() {
 				r.startSchedulerID.Stop()
 				r.startSchedulerID = nil
 			}
-
+		case <-r.closed:
+			return
 		}
 	}
 }
 
+// Close 房间从联盟中移除后停止stopSchedule 可以重复调用
+func (r *Room) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+}
+
 func (r *Room) GetRoomInfo() *proto.RoomInfo {
 	if r.roomDismissed {
 		return nil
@@ -1481,6 +1610,8 @@ func (r *Room) IsUserInRoom(uid string) bool {
 }
 
 func (r *Room) UpdateLotteryInfo(status *entity.ResultLotteryInfo) {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
 	r.resultLotteryInfo = status
 }
 
@@ -1526,7 +1657,9 @@ func (r *Room) createHongBaoList() {
 			arr = append(arr, -1)
 		}
 	}
+	r.stateLock.Lock()
 	r.userGetHongBaoCountArr = arr
+	r.stateLock.Unlock()
 }
 
 func (r *Room) getUids() []string {
@@ -1551,12 +1684,20 @@ func (r *Room) collectionRoomRentWhenStart(session *remote.Session) error {
 				newUserDataArr = append(newUserDataArr, r.UserService.UpdateUserData(matchData, savaData))
 			}
 			for _, updateUserData := range newUserDataArr {
+				if updateUserData == nil {
+					continue
+				}
+				r.recordRent(updateUserData.Uid, r.GameRule.PayDiamond)
 				if updateUserData.FrontendId != "" {
 					r.UserService.UpdateUserDataNotify(updateUserData.Uid, updateUserData.FrontendId, map[string]any{"gold": updateUserData.Gold}, session)
 				}
 			}
 		} else if r.GameRule.PayType == enums.MyPay {
 			newUserData := r.UserService.UpdateUserData(bson.M{"uid": r.RoomCreator.Uid}, bson.M{"$inc": bson.M{"gold": -r.GameRule.PayDiamond}})
+			if newUserData == nil {
+				return nil
+			}
+			r.recordRent(newUserData.Uid, r.GameRule.PayDiamond)
 			if newUserData.FrontendId != "" {
 				r.UserService.UpdateUserDataNotify(newUserData.Uid, newUserData.FrontendId, map[string]any{"gold": newUserData.Gold}, session)
 			}
@@ -1586,6 +1727,7 @@ func (r *Room) collectionRoomRentWhenStart(session *remote.Session) error {
 			if userData == nil {
 				return biz.NotEnoughGold
 			} else {
+				r.recordRent(userData.Uid, payDiamondCount)
 				if userData.FrontendId != "" {
 					r.UserService.UpdateUserDataNotify(userData.Uid, userData.FrontendId, map[string]any{"gold": userData.Gold}, session)
 				}
@@ -1595,6 +1737,33 @@ func (r *Room) collectionRoomRentWhenStart(session *remote.Session) error {
 	return nil
 }
 
+// recordRent 记录首局开始时实际收取的房费 之后的局收取的不退还
+func (r *Room) recordRent(uid string, gold int) {
+	if r.curBureau != 0 {
+		return
+	}
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
+	if r.rentCharged == nil {
+		r.rentCharged = make(map[string]int)
+	}
+	r.rentCharged[uid] += gold
+}
+
+// refundRoomRent 按collectionRoomRentWhenStart记录的实际收取的房费退还
+func (r *Room) refundRoomRent(session *remote.Session) {
+	r.stateLock.Lock()
+	charged := r.rentCharged
+	r.rentCharged = nil
+	r.stateLock.Unlock()
+	for uid, gold := range charged {
+		userData := r.UserService.UpdateUserData(bson.M{"uid": uid}, bson.M{"$inc": bson.M{"gold": gold}})
+		if userData != nil && userData.FrontendId != "" {
+			r.UserService.UpdateUserDataNotify(userData.Uid, userData.FrontendId, map[string]any{"gold": userData.Gold}, session)
+		}
+	}
+}
+
 func (r *Room) recordAllDrawResult(session *remote.Session) {
 	if !r.hasFinishedOneBureau {
 		return
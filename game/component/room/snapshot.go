@@ -0,0 +1,263 @@
+package room
+
+import (
+	"context"
+	"core/dao"
+	"core/models/entity"
+	"encoding/json"
+	"framework/remote"
+	"game/component/base"
+	"game/component/proto"
+	"time"
+)
+
+// Snapshot 房间和牌局的快照 游戏服崩溃重启后据此恢复房间 玩家重连后回到同一局
+type Snapshot struct {
+	Id                     string                      `json:"id"`
+	UnionID                int64                       `json:"unionID"`
+	GameRule               proto.GameRule              `json:"gameRule"`
+	RoomCreator            *proto.RoomCreator          `json:"roomCreator"`
+	Users                  map[string]*proto.RoomUser  `json:"users"`
+	GameStarted            bool                        `json:"gameStarted"`
+	ChairCount             int                         `json:"chairCount"`
+	CurrentUserCount       int                         `json:"currentUserCount"`
+	RoomType               TypeRoom                    `json:"roomType"`
+	CreateTime             time.Time                   `json:"createTime"`
+	LastNativeTime         time.Time                   `json:"lastNativeTime"`
+	HasFinishedOneBureau   bool                        `json:"hasFinishedOneBureau"`
+	HasStartedOneBureau    bool                        `json:"hasStartedOneBureau"`
+	AlreadyCostUserUidArr  []string                    `json:"alreadyCostUserUidArr"`
+	RentCharged            map[string]int              `json:"rentCharged"`
+	UserJoinGameBureau     map[string]int              `json:"userJoinGameBureau"`
+	MaxBureau              int                         `json:"maxBureau"`
+	CurBureau              int                         `json:"curBureau"`
+	ClearUserArr           map[string]*entity.GameUser `json:"clearUserArr"`
+	ResultLotteryInfo      *entity.ResultLotteryInfo   `json:"resultLotteryInfo"`
+	UserGetHongBaoCountArr []int                       `json:"userGetHongBaoCountArr"`
+	GameFrame              json.RawMessage             `json:"gameFrame"`
+}
+
+// ParseSnapshot 解析快照 恢复前需要根据UnionID找到房间所属的联盟
+func ParseSnapshot(data []byte) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Snapshot 序列化房间当前的状态 解散投票中的状态不保存 恢复后需要重新发起
+// 持有stateLock 避免序列化时其他协程写入房间的map
+func (r *Room) Snapshot() ([]byte, error) {
+	r.stateLock.Lock()
+	defer r.stateLock.Unlock()
+	return r.snapshot()
+}
+
+// snapshot 需要持有stateLock
+func (r *Room) snapshot() ([]byte, error) {
+	frame, err := r.GameFrame.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&Snapshot{
+		Id:                     r.Id,
+		UnionID:                r.unionID,
+		GameRule:               r.GameRule,
+		RoomCreator:            r.RoomCreator,
+		Users:                  r.users,
+		GameStarted:            r.gameStarted,
+		ChairCount:             r.chairCount,
+		CurrentUserCount:       r.currentUserCount,
+		RoomType:               r.roomType,
+		CreateTime:             r.createTime,
+		LastNativeTime:         r.lastNativeTime,
+		HasFinishedOneBureau:   r.hasFinishedOneBureau,
+		HasStartedOneBureau:    r.hasStartedOneBureau,
+		AlreadyCostUserUidArr:  r.alreadyCostUserUidArr,
+		RentCharged:            r.rentCharged,
+		UserJoinGameBureau:     r.userJoinGameBureau,
+		MaxBureau:              r.maxBureau,
+		CurBureau:              r.curBureau,
+		ClearUserArr:           r.clearUserArr,
+		ResultLotteryInfo:      r.resultLotteryInfo,
+		UserGetHongBaoCountArr: r.userGetHongBaoCountArr,
+		GameFrame:              frame,
+	})
+}
+
+// snapshotTask 交给房间写协程的快照和目录 写入前再次保存时只保留最新的一份
+type snapshotTask struct {
+	snapshot  []byte
+	directory *dao.UnionRoom
+	deleted   bool //房间解散 删除快照和目录
+}
+
+// SaveSnapshot 房间或牌局状态变化时保存快照 在stateLock下序列化 写入交给房间的写协程 失败只记录日志 不影响游戏进行
+func (r *Room) SaveSnapshot() {
+	//创建房间时牌局还没有初始化 解散后快照已经删除 迁移中由新的游戏服保存
+	if r.GameFrame == nil || r.roomDismissed || r.migrating || r.RedisService == nil {
+		return
+	}
+	r.stateLock.Lock()
+	data, err := r.snapshot()
+	entry := r.directoryEntry()
+	r.stateLock.Unlock()
+	if err != nil {
+		r.logger().Error("room SaveSnapshot marshal err:%v", err)
+		return
+	}
+	r.queueSnapshot(&snapshotTask{snapshot: data, directory: entry})
+}
+
+// deleteSnapshot 房间解散时删除快照和目录 和保存走同一个写协程 保证删除在最后
+func (r *Room) deleteSnapshot() {
+	if r.RedisService == nil {
+		return
+	}
+	r.queueSnapshot(&snapshotTask{deleted: true})
+}
+
+func (r *Room) queueSnapshot(task *snapshotTask) {
+	r.pendingLock.Lock()
+	if p := r.pending; p != nil && !task.deleted {
+		if task.snapshot == nil {
+			task.snapshot = p.snapshot
+		}
+		if task.directory == nil {
+			task.directory = p.directory
+		}
+	}
+	r.pending = task
+	r.pendingLock.Unlock()
+	select {
+	case <-r.closed:
+		//房间已经移除 写协程已经退出 直接写入
+		r.flushSnapshot()
+		return
+	default:
+	}
+	r.writerOnce.Do(func() {
+		go r.snapshotWriter()
+	})
+	select {
+	case r.snapshotSignal <- struct{}{}:
+	default:
+	}
+}
+
+// snapshotWriter 每个房间一个写协程 房间关闭时写入剩余的数据后退出
+func (r *Room) snapshotWriter() {
+	for {
+		select {
+		case <-r.snapshotSignal:
+			r.flushSnapshot()
+		case <-r.closed:
+			r.flushSnapshot()
+			return
+		}
+	}
+}
+
+func (r *Room) flushSnapshot() {
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+	r.pendingLock.Lock()
+	task := r.pending
+	r.pending = nil
+	r.pendingLock.Unlock()
+	if task == nil {
+		return
+	}
+	if task.deleted {
+		err := r.RedisService.DeleteRoomSnapshot(context.Background(), r.serverId, r.Id)
+		if err != nil {
+			r.logger().Error("room deleteSnapshot err:%v", err)
+		}
+		r.deleteDirectory()
+		return
+	}
+	//冻结之前序列化的快照不再写入 由新的游戏服保存
+	if r.migrating {
+		return
+	}
+	if task.snapshot != nil {
+		err := r.RedisService.SaveRoomSnapshot(context.Background(), r.serverId, r.Id, task.snapshot)
+		if err != nil {
+			r.logger().Error("room SaveSnapshot err:%v", err)
+		}
+	}
+	if task.directory != nil {
+		r.writeDirectory(task.directory)
+	}
+}
+
+// RestoreRoom 根据快照重建房间和牌局 并重新启动定时器 session使用节点自己的session
+func RestoreRoom(s *Snapshot, u base.UnionBase, session *remote.Session) (*Room, error) {
+	//先用空的房间创建牌局 避免初始化时给玩家推送状态
+	r, err := NewRoom(s.Id, s.RoomCreator, s.GameRule, u, session)
+	if err != nil {
+		return nil, err
+	}
+	r.users = s.Users
+	if r.users == nil {
+		r.users = make(map[string]*proto.RoomUser)
+	}
+	r.gameStarted = s.GameStarted
+	r.chairCount = s.ChairCount
+	r.currentUserCount = s.CurrentUserCount
+	r.roomType = s.RoomType
+	r.createTime = s.CreateTime
+	r.lastNativeTime = s.LastNativeTime
+	r.hasFinishedOneBureau = s.HasFinishedOneBureau
+	r.hasStartedOneBureau = s.HasStartedOneBureau
+	r.alreadyCostUserUidArr = s.AlreadyCostUserUidArr
+	r.rentCharged = s.RentCharged
+	if s.UserJoinGameBureau != nil {
+		r.userJoinGameBureau = s.UserJoinGameBureau
+	}
+	r.maxBureau = s.MaxBureau
+	r.curBureau = s.CurBureau
+	r.clearUserArr = s.ClearUserArr
+	r.resultLotteryInfo = s.ResultLotteryInfo
+	if s.UserGetHongBaoCountArr != nil {
+		r.userGetHongBaoCountArr = s.UserGetHongBaoCountArr
+	}
+	if err := r.GameFrame.Restore(s.GameFrame, session); err != nil {
+		return nil, err
+	}
+	//还没有开始过的房间 未准备的玩家继续踢出倒计时 房间还没有加入联盟 直接在当前协程注册
+	for uid := range r.users {
+		r.addKickScheduleEvent(session, uid)
+	}
+	return r, nil
+}
+
+// Freeze 迁移前冻结房间 停止所有定时器 返回冻结时的快照 之后不再保存快照和接受新玩家
+func (r *Room) Freeze() ([]byte, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.migrating = true
+	for uid, t := range r.kickSchedules {
+		t.Stop()
+		delete(r.kickSchedules, uid)
+	}
+	if r.startSchedulerID != nil {
+		r.startSchedulerID.Stop()
+	}
+	if r.answerExitSchedule != nil {
+		r.answerExitSchedule.Stop()
+	}
+	r.GameFrame.StopSchedules()
+	//丢弃还没有写入的快照 等待正在进行的写入结束 之后由新的游戏服保存
+	r.writeLock.Lock()
+	r.pendingLock.Lock()
+	r.pending = nil
+	r.pendingLock.Unlock()
+	r.writeLock.Unlock()
+	return r.Snapshot()
+}
+
+func (r *Room) IsMigrating() bool {
+	return r.migrating
+}
@@ -0,0 +1,80 @@
+package room
+
+import (
+	"common/config"
+	"common/logs"
+	"core/models/enums"
+	"encoding/json"
+	"framework/protocol"
+	"framework/pusher"
+	"framework/remote"
+	"framework/stream"
+	"game/component/proto"
+	"testing"
+	"time"
+)
+
+type testUnion struct{}
+
+func (u *testUnion) DestroyRoom(string)  {}
+func (u *testUnion) GetOwnerUid() string { return "" }
+func (u *testUnion) IsOpening() bool     { return true }
+
+func TestRestoreRoomPushThroughNodeSession(t *testing.T) {
+	config.Conf = new(config.Config)
+	logs.InitLog("room")
+	bus := remote.NewLocalBus()
+	connectorChan := make(chan []byte, 8)
+	connector := bus.Builder()("connector-001", connectorChan)
+	_ = connector.Run()
+	client := bus.Builder()("game-001", make(chan []byte, 8))
+	_ = client.Run()
+	pusher.NewPusher(client)
+	//和node.App.NewSession一样 恢复房间时没有客户端请求
+	session := remote.NewSession(client, &stream.Msg{
+		Src:  "game-001",
+		Dst:  "game-001",
+		Body: &protocol.Message{Type: protocol.Push},
+	})
+	session.SetServerId("game-001")
+
+	rule := proto.GameRule{GameType: enums.SZ, MaxPlayerCount: 3, BaseScore: 1}
+	r, err := NewRoom("100001", &proto.RoomCreator{Uid: "1001", UnionID: 1}, rule, &testUnion{}, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.users["1001"] = &proto.RoomUser{
+		Uid:      "1001",
+		UserInfo: &proto.UserInfo{Uid: "1001", FrontendId: "connector-001"},
+	}
+	r.currentUserCount = 1
+	data, err := r.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ParseSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := RestoreRoom(s, &testUnion{}, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.cancelAllScheduler()
+	if restored.UserCount() != 1 || restored.users["1001"] == nil {
+		t.Fatalf("users not restored: %+v", restored.users)
+	}
+	restored.sendData(map[string]any{"type": 1}, session.GetMsg())
+	select {
+	case res := <-connectorChan:
+		var msg stream.Msg
+		if err := json.Unmarshal(res, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Body == nil || msg.Body.Type != protocol.Push || len(msg.PushUser) != 1 {
+			t.Fatalf("unexpected push %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("push not received")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"game/component/base"
 	"game/component/proto"
 	"github.com/jinzhu/copier"
+	"sync"
 	"time"
 )
 
@@ -30,6 +31,8 @@ type GameFrame struct {
 	endResultID             *time.Timer
 	stopPourScoreScheduleID chan struct{}
 	stopForcePrepareID      chan struct{}
+	snapshotLock            sync.Mutex //UserWinRecord写入和序列化快照时加锁
+	saved                   []byte     //最近一次序列化的牌局状态
 }
 
 func (g *GameFrame) GetGameBureauData() any {
@@ -210,23 +213,7 @@ func (g *GameFrame) startGame(session *remote.Session) {
 		g.forcePrepareID.Stop()
 		g.forcePrepareID = nil
 	}
-	if g.gameRule.CanTrust && g.userTrustID == nil {
-		g.userTrustID = tasks.NewTask("userTrustID", time.Second, func() {
-			if g.r.IsDismissing() {
-				return
-			}
-			for _, u := range g.r.GetUsers() {
-				if u.ChairID == g.gameData.CurChairID &&
-					!g.gameData.UserTrustArray[u.ChairID] &&
-					g.gameData.GameStatus == PourScore {
-					g.gameData.TrustTmArray[u.ChairID]++
-					if g.gameData.TrustTmArray[u.ChairID] >= 30 {
-						g.onGameTrust(u, true, session)
-					}
-				}
-			}
-		})
-	}
+	g.startTrustSchedule(session)
 	if g.r.GetCurBureau() == 0 {
 		var idArray []int
 		for _, v := range g.r.GetUsers() {
@@ -262,6 +249,28 @@ func (g *GameFrame) startGame(session *remote.Session) {
 	g.sendDataAll(GameRoundPushData(g.gameData.Round), session)
 }
 
+// startTrustSchedule 超时未操作的玩家自动托管
+func (g *GameFrame) startTrustSchedule(session *remote.Session) {
+	if !g.gameRule.CanTrust || g.userTrustID != nil {
+		return
+	}
+	g.userTrustID = tasks.NewTask("userTrustID", time.Second, func() {
+		if g.r.IsDismissing() {
+			return
+		}
+		for _, u := range g.r.GetUsers() {
+			if u.ChairID == g.gameData.CurChairID &&
+				!g.gameData.UserTrustArray[u.ChairID] &&
+				g.gameData.GameStatus == PourScore {
+				g.gameData.TrustTmArray[u.ChairID]++
+				if g.gameData.TrustTmArray[u.ChairID] >= 30 {
+					g.onGameTrust(u, true, session)
+				}
+			}
+		}
+	})
+}
+
 func (g *GameFrame) getAllUsers() []string {
 	users := make([]string, 0)
 	for _, v := range g.r.GetUsers() {
@@ -343,6 +352,7 @@ func (g *GameFrame) onGameLook(user *proto.RoomUser, cuopai bool, fromUser bool,
 
 		}
 	}
+	g.saveSnapshot()
 }
 
 /*
@@ -425,6 +435,7 @@ func (g *GameFrame) onGamePourScore(chairID int,
 		}
 		g.sendDataAll(GamePourScorePushData(user.ChairID, score, chairScore, scores, types), session)
 	}
+	g.saveSnapshot()
 	if !fromCompare {
 		//结束下分 不是比牌下注
 		g.endPourScore(false, session)
@@ -580,6 +591,7 @@ func (g *GameFrame) onGameCompare(fromChairID int, toChairID int, fromEnd, force
 			g.endPourScore((winChairID == fromChairID) && force, session)
 		})
 	}
+	g.saveSnapshot()
 }
 
 func (g *GameFrame) startResult(session *remote.Session) {
@@ -640,6 +652,7 @@ func (g *GameFrame) startResult(session *remote.Session) {
 	for i := 0; i < len(winScores); i++ {
 		user := g.getUserByChairID(i)
 		if winScores[i] != 0 && user != nil {
+			g.snapshotLock.Lock()
 			if g.UserWinRecord[user.UserInfo.Uid] == nil {
 				g.UserWinRecord[user.UserInfo.Uid] = &UserWinRecord{
 					Uid:      user.UserInfo.Uid,
@@ -649,6 +662,7 @@ func (g *GameFrame) startResult(session *remote.Session) {
 				}
 			}
 			g.UserWinRecord[user.UserInfo.Uid].Score += winScores[i]
+			g.snapshotLock.Unlock()
 		}
 	}
 	result := &GameResult{
@@ -705,6 +719,8 @@ func (g *GameFrame) resetGame(session *remote.Session) {
 
 func (g *GameFrame) SendGameStatus(session *remote.Session) {
 	g.sendDataAll(GameStatusPushData(g.gameData.GameStatus, g.gameData.Tick), session)
+	//游戏状态变化时保存房间快照
+	g.saveSnapshot()
 }
 
 func (g *GameFrame) gameEnd(session *remote.Session) {
@@ -725,34 +741,39 @@ func (g *GameFrame) gameEnd(session *remote.Session) {
 	g.r.ConcludeGame(endData, session)
 	g.gameData.Tick = 3
 	if g.r.GetCurBureau() != g.r.GetMaxBureau() {
-		if g.forcePrepareID != nil {
-			g.forcePrepareID.Stop()
-			g.forcePrepareID = nil
+		g.startForcePrepare(session)
+	}
+}
+
+// startForcePrepare 小局结束后倒计时 结束时自动准备
+func (g *GameFrame) startForcePrepare(session *remote.Session) {
+	if g.forcePrepareID != nil {
+		g.forcePrepareID.Stop()
+		g.forcePrepareID = nil
+	}
+	g.forcePrepareID = tasks.NewTask("forcePrepareID", 1*time.Second, func() {
+		if g.r.IsDismissing() {
+			return
 		}
-		g.forcePrepareID = tasks.NewTask("forcePrepareID", 1*time.Second, func() {
-			if g.r.IsDismissing() {
-				return
-			}
-			g.gameData.Tick--
-			if g.gameData.Tick <= 0 {
-				if g.gameData.GameStatus == GameStatusNone {
-					for _, user := range g.r.GetUsers() {
-						if user.UserStatus&enums.Ready > 0 {
-							//手动准备过，倒计时清零
-							g.gameData.TrustTmArray[user.ChairID] = 0
-						}
-						if user.ChairID < g.gameData.ChairCount &&
-							user.UserStatus&enums.Ready == 0 &&
-							g.gameData.GameStatus == GameStatusNone &&
-							!g.gameData.GameStarter {
-							g.r.UserReady(user.UserInfo.Uid, session)
-						}
+		g.gameData.Tick--
+		if g.gameData.Tick <= 0 {
+			if g.gameData.GameStatus == GameStatusNone {
+				for _, user := range g.r.GetUsers() {
+					if user.UserStatus&enums.Ready > 0 {
+						//手动准备过，倒计时清零
+						g.gameData.TrustTmArray[user.ChairID] = 0
+					}
+					if user.ChairID < g.gameData.ChairCount &&
+						user.UserStatus&enums.Ready == 0 &&
+						g.gameData.GameStatus == GameStatusNone &&
+						!g.gameData.GameStarter {
+						g.r.UserReady(user.UserInfo.Uid, session)
 					}
 				}
-				g.stopForcePrepareID <- struct{}{}
 			}
-		})
-	}
+			g.stopForcePrepareID <- struct{}{}
+		}
+	})
 }
 
 func (g *GameFrame) onGameAbandon(chairID int, types int, fromUser bool, session *remote.Session) {
@@ -775,6 +796,7 @@ func (g *GameFrame) onGameAbandon(chairID int, types int, fromUser bool, session
 	}
 	g.gameData.Loser = append(g.gameData.Loser, chairID)
 	g.sendDataAll(GameAbandonPushData(chairID, g.gameData.UserStatusArray[chairID], types), session)
+	g.saveSnapshot()
 	time.AfterFunc(time.Second, func() {
 		g.endPourScore(false, session)
 	})
@@ -876,19 +898,7 @@ func (g *GameFrame) startPourScore(session *remote.Session) {
 	g.gameData.Tick = TmPourScore
 	//推送游戏状态
 	g.gameData.GameStatus = PourScore
-	if g.pourScoreScheduleID != nil {
-		g.pourScoreScheduleID.Stop()
-		g.pourScoreScheduleID = nil
-	}
-	g.pourScoreScheduleID = tasks.NewTask("pourScoreScheduleID", 1*time.Second, func() {
-		if g.r.IsDismissing() {
-			return
-		}
-		g.gameData.Tick--
-		if g.gameData.Tick <= 0 {
-			g.onGameAbandon(g.gameData.CurChairID, 1, false, session)
-		}
-	})
+	g.startPourScoreSchedule(session)
 	g.SendGameStatus(session)
 	g.sendDataAll(GameTurnPushData(g.gameData.CurChairID, g.gameData.CurScore), session)
 	chairID := g.gameData.CurChairID
@@ -906,6 +916,23 @@ func (g *GameFrame) startPourScore(session *remote.Session) {
 	})
 }
 
+// startPourScoreSchedule 下分倒计时 倒计时结束自动弃牌
+func (g *GameFrame) startPourScoreSchedule(session *remote.Session) {
+	if g.pourScoreScheduleID != nil {
+		g.pourScoreScheduleID.Stop()
+		g.pourScoreScheduleID = nil
+	}
+	g.pourScoreScheduleID = tasks.NewTask("pourScoreScheduleID", 1*time.Second, func() {
+		if g.r.IsDismissing() {
+			return
+		}
+		g.gameData.Tick--
+		if g.gameData.Tick <= 0 {
+			g.onGameAbandon(g.gameData.CurChairID, 1, false, session)
+		}
+	})
+}
+
 func (g *GameFrame) delScheduleIDs() {
 	if g.userTrustID != nil {
 		g.userTrustID.Stop()
@@ -0,0 +1,110 @@
+package sz
+
+import (
+	"common/logs"
+	"encoding/json"
+	"framework/remote"
+	"time"
+)
+
+// snapshot 牌局中需要持久化的状态 定时器在恢复时根据游戏状态重新启动
+type snapshot struct {
+	GameData      *GameData                 `json:"gameData"`
+	UserWinRecord map[string]*UserWinRecord `json:"userWinRecord"`
+	ReviewRecord  []*BureauReview           `json:"reviewRecord"`
+	Cards         []int                     `json:"cards"`
+	GameResult    *GameResult               `json:"gameResult"`
+}
+
+// Snapshot 返回最近一次保存的牌局状态 房间序列化时调用 这里不读取牌局数据
+func (g *GameFrame) Snapshot() ([]byte, error) {
+	g.snapshotLock.Lock()
+	defer g.snapshotLock.Unlock()
+	return g.saved, nil
+}
+
+// capture 序列化牌局状态 在修改牌局状态的流程中调用 UserWinRecord的写入同样持有snapshotLock
+func (g *GameFrame) capture() {
+	g.logic.RLock()
+	cards := append([]int{}, g.logic.cards...)
+	g.logic.RUnlock()
+	g.snapshotLock.Lock()
+	defer g.snapshotLock.Unlock()
+	data, err := json.Marshal(&snapshot{
+		GameData:      g.gameData,
+		UserWinRecord: g.UserWinRecord,
+		ReviewRecord:  g.ReviewRecord,
+		Cards:         cards,
+		GameResult:    g.gameResult,
+	})
+	if err != nil {
+		logs.Error("sz capture snapshot err:%v, roomId=%s", err, g.r.GetId())
+		return
+	}
+	g.saved = data
+}
+
+// saveSnapshot 下分 比牌 弃牌 看牌和游戏状态变化时保存快照
+func (g *GameFrame) saveSnapshot() {
+	g.capture()
+	g.r.SaveSnapshot()
+}
+
+// Restore 从快照恢复牌局 并按当前的游戏状态重新启动定时器
+func (g *GameFrame) Restore(data []byte, session *remote.Session) error {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s.GameData != nil {
+		g.gameData = s.GameData
+	}
+	if s.UserWinRecord != nil {
+		g.UserWinRecord = s.UserWinRecord
+	}
+	if s.ReviewRecord != nil {
+		g.ReviewRecord = s.ReviewRecord
+	}
+	g.logic.Lock()
+	g.logic.cards = s.Cards
+	g.logic.Unlock()
+	g.gameResult = s.GameResult
+	g.capture()
+	g.rearmSchedules(session)
+	return nil
+}
+
+func (g *GameFrame) rearmSchedules(session *remote.Session) {
+	if g.gameData.GameStarter && g.r.GetGameStarted() {
+		g.startTrustSchedule(session)
+	}
+	switch g.gameData.GameStatus {
+	case SendCards:
+		g.sendCardsScheduleID = time.AfterFunc(time.Duration(TmSendCards)*time.Second, func() {
+			g.endSendCards(session)
+		})
+	case PourScore:
+		//倒计时从快照中的剩余时间继续
+		g.startPourScoreSchedule(session)
+	case Result:
+		if g.gameResult != nil {
+			g.endResultID = time.AfterFunc(3*time.Second, func() {
+				g.endResult(session)
+			})
+		}
+	default:
+		if g.r.GetCurBureau() > 0 && !g.r.GetGameStarted() && g.r.GetCurBureau() != g.r.GetMaxBureau() {
+			g.startForcePrepare(session)
+		}
+	}
+}
+
+// StopSchedules 停止牌局的所有定时器 房间迁移到其他游戏服后由新的游戏服继续
+func (g *GameFrame) StopSchedules() {
+	g.delScheduleIDs()
+	for _, t := range []*time.Timer{g.startPourScoreID, g.sendCardsScheduleID, g.compareID, g.endResultID} {
+		if t != nil {
+			t.Stop()
+		}
+	}
+}
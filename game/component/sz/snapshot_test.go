@@ -0,0 +1,61 @@
+package sz
+
+import (
+	"framework/remote"
+	"framework/stream"
+	"game/component/proto"
+	"reflect"
+	"testing"
+)
+
+type testRoom struct {
+	users map[string]*proto.RoomUser
+}
+
+func (r *testRoom) GetUsers() map[string]*proto.RoomUser           { return r.users }
+func (r *testRoom) GetId() string                                  { return "100001" }
+func (r *testRoom) EndGame(*remote.Session)                        {}
+func (r *testRoom) UserReady(string, *remote.Session)              {}
+func (r *testRoom) SendData(*stream.Msg, []string, any)            {}
+func (r *testRoom) SendDataAll(*stream.Msg, any)                   {}
+func (r *testRoom) GetCreator() *proto.RoomCreator                 { return &proto.RoomCreator{} }
+func (r *testRoom) ConcludeGame([]*proto.EndData, *remote.Session) {}
+func (r *testRoom) IsDismissing() bool                             { return false }
+func (r *testRoom) SetCurBureau(int)                               {}
+func (r *testRoom) GetCurBureau() int                              { return 0 }
+func (r *testRoom) GetMaxBureau() int                              { return 8 }
+func (r *testRoom) GetHongBaoList() any                            { return nil }
+func (r *testRoom) GetGameStarted() bool                           { return false }
+func (r *testRoom) SaveSnapshot()                                  {}
+
+func TestSnapshotRestore(t *testing.T) {
+	session := remote.NewSession(nil, &stream.Msg{})
+	rule := proto.GameRule{MaxPlayerCount: 3, BaseScore: 1}
+	r := &testRoom{users: map[string]*proto.RoomUser{}}
+	g := NewGameFrame(rule, r, session)
+	g.logic.washCards()
+	g.gameData.HandCards[0] = g.logic.getCards()
+	g.gameData.PourScores[0] = []int{1, 2}
+	g.gameData.BankerChairID = 2
+	g.UserWinRecord["1"] = &UserWinRecord{Uid: "1", Score: 5}
+	g.ReviewRecord = append(g.ReviewRecord, &BureauReview{Uid: "1", WinScore: 5})
+
+	g.capture()
+	data, err := g.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewGameFrame(rule, r, session)
+	if err := restored.Restore(data, session); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored.gameData, g.gameData) {
+		t.Fatalf("gameData = %+v, want %+v", restored.gameData, g.gameData)
+	}
+	if !reflect.DeepEqual(restored.logic.cards, g.logic.cards) {
+		t.Fatalf("cards = %v, want %v", restored.logic.cards, g.logic.cards)
+	}
+	if restored.UserWinRecord["1"].Score != 5 || len(restored.ReviewRecord) != 1 {
+		t.Fatalf("records not restored: %+v %+v", restored.UserWinRecord, restored.ReviewRecord)
+	}
+}
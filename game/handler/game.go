@@ -5,7 +5,6 @@ import (
 	"common/biz"
 	"core/repo"
 	"core/service"
-	"encoding/json"
 	"fmt"
 	"framework/remote"
 	"game/logic"
@@ -13,28 +12,27 @@ import (
 )
 
 type GameHandler struct {
-	um          *logic.UnionManager
-	userService *service.UserService
+	um           *logic.UnionManager
+	userService  *service.UserService
+	redisService *service.RedisService
 }
 
-func (h *GameHandler) RoomMessageNotify(session *remote.Session, msg []byte) any {
+func (h *GameHandler) RoomMessageNotify(session *remote.Session, req *request.RoomMessageReq) any {
 	if len(session.GetUid()) <= 0 {
 		return common.F(biz.InvalidUsers)
 	}
-	var req request.RoomMessageReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
 	//room去处理这块的业务
 	roomId, ok := session.Get("roomId")
 	if !ok {
 		return common.F(biz.NotInRoom)
 	}
+	//房间迁移中时等迁移结束 再按房间的归属处理
+	h.um.WaitMigration(fmt.Sprintf("%v", roomId))
 	rm := h.um.GetRoomById(fmt.Sprintf("%v", roomId))
 	if rm == nil {
-		return common.F(biz.NotInRoom)
+		return h.proxyRoom(session, fmt.Sprintf("%v", roomId))
 	}
-	rm.ReceiveRoomMessage(session, req)
+	rm.ReceiveRoomMessage(session, *req)
 	return nil
 }
 
@@ -47,17 +45,32 @@ func (h *GameHandler) GameMessageNotify(session *remote.Session, msg []byte) any
 	if !ok {
 		return common.F(biz.NotInRoom)
 	}
+	//房间迁移中时等迁移结束 再按房间的归属处理
+	h.um.WaitMigration(fmt.Sprintf("%v", roomId))
 	rm := h.um.GetRoomById(fmt.Sprintf("%v", roomId))
 	if rm == nil {
-		return common.F(biz.NotInRoom)
+		return h.proxyRoom(session, fmt.Sprintf("%v", roomId))
 	}
 	rm.GameMessageHandle(session, msg)
 	return nil
 }
 
+// proxyRoom 房间不在当前节点时转发到房间所在的节点 比如房间所在的节点正在停机排空
+func (h *GameHandler) proxyRoom(session *remote.Session, roomId string) any {
+	isCurrent, err := Proxy(h.redisService, session, roomId)
+	if err != nil {
+		return common.F(err)
+	}
+	if isCurrent {
+		return common.F(biz.NotInRoom)
+	}
+	return nil
+}
+
 func NewGameHandler(r *repo.Manager, um *logic.UnionManager) *GameHandler {
 	return &GameHandler{
-		um:          um,
-		userService: service.NewUserService(r),
+		um:           um,
+		userService:  service.NewUserService(r),
+		redisService: service.NewRedisService(r),
 	}
 }
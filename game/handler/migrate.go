@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"common"
+	"common/biz"
+	"core/repo"
+	"core/service"
+	"framework/remote"
+	"game/logic"
+	"game/models/request"
+)
+
+// MigrateHandler 房间在游戏服之间迁移 只允许节点之间的rpc调用 用于滚动发布
+type MigrateHandler struct {
+	um           *logic.UnionManager
+	userService  *service.UserService
+	redisService *service.RedisService
+	unionService *service.UnionService
+}
+
+// MigrateRoom 将当前节点上的房间迁移到req.Dst 停机排空时也会按同样的流程迁移
+func (h *MigrateHandler) MigrateRoom(session *remote.Session, req *request.MigrateRoomReq) any {
+	if !isRPC(session) {
+		return common.F(biz.RequestDataError)
+	}
+	if req.Dst == "" || req.Dst == session.GetServerId() {
+		return common.F(biz.RequestDataError)
+	}
+	if err := h.um.MigrateRoom(session, req.RoomID, req.Dst, h.redisService); err != nil {
+		return common.F(err)
+	}
+	return common.S(nil)
+}
+
+// ImportRoom 接管其他游戏服迁移过来的房间
+func (h *MigrateHandler) ImportRoom(session *remote.Session, req *request.ImportRoomReq) any {
+	if !isRPC(session) {
+		return common.F(biz.RequestDataError)
+	}
+	if err := h.um.ImportRoom(session, req.Snapshot, req.From, h.redisService, h.userService, h.unionService); err != nil {
+		return common.F(err)
+	}
+	return common.S(nil)
+}
+
+// isRPC 客户端的请求经过connector转发 没有Reply
+func isRPC(session *remote.Session) bool {
+	return session.GetMsg().Reply != ""
+}
+
+func NewMigrateHandler(r *repo.Manager, um *logic.UnionManager) *MigrateHandler {
+	return &MigrateHandler{
+		um:           um,
+		userService:  service.NewUserService(r),
+		redisService: service.NewRedisService(r),
+		unionService: service.NewUnionService(r),
+	}
+}
@@ -1,16 +1,22 @@
 package handler
 
 import (
+	"common"
 	"common/biz"
 	"common/logs"
-	"context"
 	"core/service"
+	"encoding/json"
 	"framework/msError"
+	"framework/node"
 	"framework/remote"
+	"game/logic"
+	"game/models/request"
 )
 
+const joinRoomRoute = "unionHandler.joinRoom"
+
 func Proxy(redisService *service.RedisService, session *remote.Session, roomId string) (bool, *msError.Error) {
-	server, err := redisService.Get(context.TODO(), roomId)
+	server, err := redisService.Get(session.Context(), roomId)
 	if err != nil {
 		return false, biz.SqlError
 	}
@@ -24,3 +30,61 @@ func Proxy(redisService *service.RedisService, session *remote.Session, roomId s
 	session.SendProxy(server)
 	return false, nil
 }
+
+// ProxyUnion 联盟请求只在联盟所在的游戏服上处理 不在当前节点时转发过去 由它回复客户端
+func ProxyUnion(um *logic.UnionManager, redisService *service.RedisService, session *remote.Session, unionId int64) (bool, *msError.Error) {
+	owner, err := um.UnionOwner(redisService, unionId, session.GetServerId())
+	if err != nil {
+		return false, err
+	}
+	if owner == session.GetServerId() {
+		return true, nil
+	}
+	logs.Info("转发联盟请求到联盟所在的game服务器,unionId=%v,dst=%v", unionId, owner)
+	session.SendProxy(owner)
+	return false, nil
+}
+
+// ProxyUnionMiddleware 按请求中的unionID转发联盟请求 只有联盟所在的游戏服才执行handler
+// skip中的路由不按联盟转发 如加入房间按房间号转发
+//
+//	n.UseRoute("unionHandler.", handler.ProxyUnionMiddleware(um, redisService, "unionHandler.joinRoom"))
+func ProxyUnionMiddleware(um *logic.UnionManager, redisService *service.RedisService, skip ...string) node.Middleware {
+	return func(router string, next node.HandlerFunc) node.HandlerFunc {
+		for _, r := range skip {
+			if r == router {
+				return next
+			}
+		}
+		return func(session *remote.Session, msg []byte) any {
+			var req struct {
+				UnionID int64 `json:"unionID"`
+			}
+			if err := json.Unmarshal(msg, &req); err != nil {
+				logs.Warn("proxy union decode request err:%v, router=%s", err, router)
+				return common.F(biz.RequestDataError)
+			}
+			isOwner, e := ProxyUnion(um, redisService, session, req.UnionID)
+			if e != nil {
+				return common.F(e)
+			}
+			if !isOwner {
+				return nil
+			}
+			return next(session, msg)
+		}
+	}
+}
+
+// dispatchJoinRoom 把请求改写成加入指定房间 转发到房间所在的游戏服 由它回复客户端
+func dispatchJoinRoom(session *remote.Session, roomId string, server string) *msError.Error {
+	data, err := session.GetSerializer().Marshal(&request.JoinRoomReq{RoomID: roomId})
+	if err != nil {
+		logs.Error("dispatchJoinRoom marshal err:%v", err)
+		return biz.Fail
+	}
+	session.GetMsg().Body.Data = data
+	logs.Info("快速加入其他game服务器的房间,roomId=%v,dst=%v", roomId, server)
+	session.Dispatch(joinRoomRoute, server)
+	return nil
+}
@@ -3,11 +3,11 @@ package handler
 import (
 	"common"
 	"common/biz"
-	"context"
 	"core/repo"
 	"core/service"
-	"encoding/json"
 	"fmt"
+	"framework/protocol"
+	"framework/pusher"
 	"framework/remote"
 	"game/logic"
 	"game/models/request"
@@ -20,7 +20,7 @@ type UnionHandler struct {
 	unionService *service.UnionService
 }
 
-func (h *UnionHandler) CreateRoom(session *remote.Session, msg []byte) any {
+func (h *UnionHandler) CreateRoom(session *remote.Session, req *request.CreateRoomReq) any {
 	//union 联盟 持有房间
 	//unionManager 管理联盟
 	//room 房间 又关联 game接口 实现多个不同的游戏
@@ -29,18 +29,23 @@ func (h *UnionHandler) CreateRoom(session *remote.Session, msg []byte) any {
 	if len(uid) <= 0 {
 		return common.F(biz.InvalidUsers)
 	}
-	var req request.CreateRoomReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
+	//停机排空中不再创建房间
+	if h.um.IsDraining() {
+		return common.F(biz.ServerDraining)
 	}
 	//2. 根据session 用户id 查询用户的信息
-	userData, err := h.userService.FindUserByUid(context.TODO(), uid)
+	userData, err := h.userService.FindUserByUid(session.Context(), uid)
 	if err != nil {
 		return common.F(err)
 	}
 	if userData == nil {
 		return common.F(biz.InvalidUsers)
 	}
+	//登录之后帐号被冻结 断开连接
+	if userData.IsBlockedAccount {
+		pusher.Kick(uid, protocol.KickBlocked)
+		return common.F(biz.BlockedAccount)
+	}
 	//3. 根据游戏规则 游戏类型 用户信息（创建房间的用户） 创建房间了
 	roomId, ok := session.Get("roomId")
 	if ok {
@@ -52,23 +57,20 @@ func (h *UnionHandler) CreateRoom(session *remote.Session, msg []byte) any {
 	}
 
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
-	err = union.CreateRoom(h.redisService, h.userService, session, req, userData)
+	err = union.CreateRoom(h.redisService, h.userService, session, *req, userData)
 	if err != nil {
 		return common.F(err)
 	}
 	return common.S(nil)
 }
 
-func (h *UnionHandler) JoinRoom(session *remote.Session, msg []byte) any {
+func (h *UnionHandler) JoinRoom(session *remote.Session, req *request.JoinRoomReq) any {
 	uid := session.GetUid()
 	if len(uid) <= 0 {
 		return common.F(biz.InvalidUsers)
 	}
-	var req request.JoinRoomReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
 	//判断roomId是否在当前服务器，如果不在转发请求
+	h.um.WaitMigration(req.RoomID)
 	isCurrent, err := Proxy(h.redisService, session, req.RoomID)
 	if err != nil {
 		return common.F(err)
@@ -87,13 +89,18 @@ func (h *UnionHandler) JoinRoom(session *remote.Session, msg []byte) any {
 			}
 		}
 	}
-	userData, err := h.userService.FindUserByUid(context.TODO(), uid)
+	userData, err := h.userService.FindUserByUid(session.Context(), uid)
 	if err != nil {
 		return common.F(err)
 	}
 	if userData == nil {
 		return common.F(biz.InvalidUsers)
 	}
+	//登录之后帐号被冻结 断开连接
+	if userData.IsBlockedAccount {
+		pusher.Kick(uid, protocol.KickBlocked)
+		return common.F(biz.BlockedAccount)
+	}
 	bizErr := h.um.JoinRoom(session, req.RoomID, userData)
 	if bizErr != nil {
 		return common.F(bizErr)
@@ -101,15 +108,8 @@ func (h *UnionHandler) JoinRoom(session *remote.Session, msg []byte) any {
 	return nil
 }
 
-func (h *UnionHandler) GetUnionInfo(session *remote.Session, msg []byte) any {
-	var req request.GetUnionReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
-	user, err := h.userService.FindUserByUid(context.TODO(), session.GetUid())
+func (h *UnionHandler) GetUnionInfo(session *remote.Session, req *request.GetUnionReq) any {
+	user, err := h.userService.FindUserByUid(session.Context(), session.GetUid())
 	if err != nil {
 		return common.F(err)
 	}
@@ -127,14 +127,7 @@ func (h *UnionHandler) GetUnionInfo(session *remote.Session, msg []byte) any {
 	return common.S(res)
 }
 
-func (h *UnionHandler) GetUnionRoomList(session *remote.Session, msg []byte) any {
-	var req request.GetUnionReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GetUnionRoomList(session *remote.Session, req *request.GetUnionReq) any {
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
 	roomList := union.GetUnionRoomList()
 	res := map[string]any{
@@ -143,15 +136,23 @@ func (h *UnionHandler) GetUnionRoomList(session *remote.Session, msg []byte) any
 	return common.S(res)
 }
 
-func (h *UnionHandler) QuickJoin(session *remote.Session, msg []byte) any {
+func (h *UnionHandler) QuickJoin(session *remote.Session, req *request.QuickJoinReq) any {
+	if h.um.IsDraining() {
+		return common.F(biz.ServerDraining)
+	}
 	uid := session.GetUid()
-	userData, err := h.userService.FindUserByUid(context.TODO(), uid)
+	userData, err := h.userService.FindUserByUid(session.Context(), uid)
 	if err != nil {
 		return common.F(err)
 	}
 	if userData == nil {
 		return common.F(biz.InvalidUsers)
 	}
+	//登录之后帐号被冻结 断开连接
+	if userData.IsBlockedAccount {
+		pusher.Kick(uid, protocol.KickBlocked)
+		return common.F(biz.BlockedAccount)
+	}
 	roomId, ok := session.Get("roomId")
 	if ok {
 		//已经在房间中
@@ -160,14 +161,14 @@ func (h *UnionHandler) QuickJoin(session *remote.Session, msg []byte) any {
 			return common.F(biz.Fail)
 		}
 	}
-	var req request.QuickJoinReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
+	//其他游戏服上有可以加入的房间 改为加入该房间
+	if roomId, server := union.FindRemoteRoom(req.GameRuleID, session.GetServerId()); server != "" {
+		if e := dispatchJoinRoom(session, roomId, server); e != nil {
+			return common.F(e)
+		}
+		return nil
+	}
 	e := union.QuickJoin(session, req.GameRuleID, userData)
 	if e.Code != biz.OK {
 		return common.F(e)
@@ -175,14 +176,17 @@ func (h *UnionHandler) QuickJoin(session *remote.Session, msg []byte) any {
 	return common.S(nil)
 }
 
-func (h *UnionHandler) GetHongBao(session *remote.Session, msg []byte) any {
-	var req request.HoneBaoReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
+// UnionChanged 联盟数据被修改 重新加载当前节点上的联盟 只处理节点之间的广播 自己发出的忽略
+func (h *UnionHandler) UnionChanged(session *remote.Session, req *request.UnionChangedReq) any {
+	msg := session.GetMsg()
+	if msg.Cid != "" || msg.Src == session.GetServerId() {
+		return nil
 	}
+	h.um.ReloadUnion(req.UnionID)
+	return nil
+}
+
+func (h *UnionHandler) GetHongBao(session *remote.Session, req *request.HoneBaoReq) any {
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
 	res, err := union.GetHongBao(session.GetUid())
 	if err != nil {
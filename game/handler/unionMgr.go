@@ -5,7 +5,6 @@ import (
 	"common/biz"
 	"core/repo"
 	"core/service"
-	"encoding/json"
 	"framework/remote"
 	"game/logic"
 	"game/models/request"
@@ -18,11 +17,7 @@ type UnionMgrHandler struct {
 	unionService *service.UnionService
 }
 
-func (h *UnionMgrHandler) AddRoomRuleList(session *remote.Session, msg []byte) any {
-	var req request.AddRoomRuleReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionMgrHandler) AddRoomRuleList(session *remote.Session, req *request.AddRoomRuleReq) any {
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
 	if session.GetUid() != union.GetOwnerUid() {
 		return common.F(biz.RequestDataError)
@@ -31,6 +26,7 @@ func (h *UnionMgrHandler) AddRoomRuleList(session *remote.Session, msg []byte) a
 	if err != nil {
 		return common.F(biz.SqlError)
 	}
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	unionInfo := union.GetUnionInfo(session.GetUid())
 	roomList := union.GetUnionRoomList()
 	res := map[string]any{
@@ -40,11 +36,7 @@ func (h *UnionMgrHandler) AddRoomRuleList(session *remote.Session, msg []byte) a
 	return common.S(res)
 }
 
-func (h *UnionMgrHandler) UpdateRoomRuleList(session *remote.Session, msg []byte) any {
-	var req request.UpdateRoomRuleReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionMgrHandler) UpdateRoomRuleList(session *remote.Session, req *request.UpdateRoomRuleReq) any {
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
 	if session.GetUid() != union.GetOwnerUid() {
 		return common.F(biz.RequestDataError)
@@ -53,6 +45,7 @@ func (h *UnionMgrHandler) UpdateRoomRuleList(session *remote.Session, msg []byte
 	if err != nil {
 		return common.F(biz.SqlError)
 	}
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	unionInfo := union.GetUnionInfo(session.GetUid())
 	roomList := union.GetUnionRoomList()
 	res := map[string]any{
@@ -62,16 +55,13 @@ func (h *UnionMgrHandler) UpdateRoomRuleList(session *remote.Session, msg []byte
 	return common.S(res)
 }
 
-func (h *UnionMgrHandler) UpdateOpeningStatus(session *remote.Session, msg []byte) any {
-	var req request.UpdateOpeningStatusReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionMgrHandler) UpdateOpeningStatus(session *remote.Session, req *request.UpdateOpeningStatusReq) any {
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
 	if session.GetUid() != union.GetOwnerUid() {
 		return common.F(biz.RequestDataError)
 	}
 	union.UpdateOpeningStatus(req.IsOpen)
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	unionInfo := union.GetUnionInfo(session.GetUid())
 	roomList := union.GetUnionRoomList()
 	res := map[string]any{
@@ -81,16 +71,13 @@ func (h *UnionMgrHandler) UpdateOpeningStatus(session *remote.Session, msg []byt
 	return common.S(res)
 }
 
-func (h *UnionMgrHandler) RemoveRoomRuleList(session *remote.Session, msg []byte) any {
-	var req request.RemoveRoomRuleReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionMgrHandler) RemoveRoomRuleList(session *remote.Session, req *request.RemoveRoomRuleReq) any {
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
 	if session.GetUid() != union.GetOwnerUid() {
 		return common.F(biz.RequestDataError)
 	}
 	union.RemoveRoomRuleList(req.RoomRuleId)
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	unionInfo := union.GetUnionInfo(session.GetUid())
 	roomList := union.GetUnionRoomList()
 	res := map[string]any{
@@ -100,14 +87,7 @@ func (h *UnionMgrHandler) RemoveRoomRuleList(session *remote.Session, msg []byte
 	return common.S(res)
 }
 
-func (h *UnionMgrHandler) UpdateUnionNotice(session *remote.Session, msg []byte) any {
-	var req request.UpdateUnionNoticeReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionMgrHandler) UpdateUnionNotice(session *remote.Session, req *request.UpdateUnionNoticeReq) any {
 	if req.Notice == "" || len(req.Notice) > 150 {
 		return common.F(biz.RequestDataError)
 	}
@@ -117,6 +97,7 @@ func (h *UnionMgrHandler) UpdateUnionNotice(session *remote.Session, msg []byte)
 		return common.F(biz.RequestDataError)
 	}
 	union.UpdateUnionNotice(req.Notice)
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	unionInfo := union.GetUnionInfo(session.GetUid())
 	roomList := union.GetUnionRoomList()
 	res := map[string]any{
@@ -126,14 +107,7 @@ func (h *UnionMgrHandler) UpdateUnionNotice(session *remote.Session, msg []byte)
 	return common.S(res)
 }
 
-func (h *UnionMgrHandler) UpdateUnionName(session *remote.Session, msg []byte) any {
-	var req request.UpdateUnionNameReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionMgrHandler) UpdateUnionName(session *remote.Session, req *request.UpdateUnionNameReq) any {
 	if req.UnionName == "" || len(req.UnionName) > 60 {
 		return common.F(biz.RequestDataError)
 	}
@@ -142,6 +116,7 @@ func (h *UnionMgrHandler) UpdateUnionName(session *remote.Session, msg []byte) a
 		return common.F(biz.RequestDataError)
 	}
 	union.UpdateUnionName(req.UnionName)
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	unionInfo := union.GetUnionInfo(session.GetUid())
 	roomList := union.GetUnionRoomList()
 	res := map[string]any{
@@ -151,29 +126,24 @@ func (h *UnionMgrHandler) UpdateUnionName(session *remote.Session, msg []byte) a
 	return common.S(res)
 }
 
-func (h *UnionMgrHandler) UpdatePartnerNoticeSwitch(session *remote.Session, msg []byte) any {
-	var req request.UpdatePartnerNoticeSwitchReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionMgrHandler) UpdatePartnerNoticeSwitch(session *remote.Session, req *request.UpdatePartnerNoticeSwitchReq) any {
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
 	if session.GetUid() != union.GetOwnerUid() {
 		return common.F(biz.RequestDataError)
 	}
 	union.UpdatePartnerNoticeSwitch(req.IsOpen)
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	return common.S(nil)
 }
 
-func (h *UnionMgrHandler) DismissRoom(session *remote.Session, msg []byte) any {
-	var req request.DismissRoomReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
+func (h *UnionMgrHandler) DismissRoom(session *remote.Session, req *request.DismissRoomReq) any {
+	//房间不一定在联盟所在的游戏服上 转发到房间所在的游戏服
+	isCurrent, e := Proxy(h.redisService, session, req.RoomID)
+	if e != nil {
+		return common.F(e)
 	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
+	if !isCurrent {
+		return nil
 	}
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
 	if session.GetUid() != union.GetOwnerUid() {
@@ -189,14 +159,7 @@ func (h *UnionMgrHandler) DismissRoom(session *remote.Session, msg []byte) any {
 	return common.S(res)
 }
 
-func (h *UnionMgrHandler) HongBaoSetting(session *remote.Session, msg []byte) any {
-	var req request.HongBaoSettingReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionMgrHandler) HongBaoSetting(session *remote.Session, req *request.HongBaoSettingReq) any {
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
 	if session.GetUid() != union.GetOwnerUid() {
 		return common.F(biz.RequestDataError)
@@ -205,22 +168,17 @@ func (h *UnionMgrHandler) HongBaoSetting(session *remote.Session, msg []byte) an
 	if err != nil {
 		return common.F(err)
 	}
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	return common.S(nil)
 }
 
-func (h *UnionMgrHandler) UpdateLotteryStatus(session *remote.Session, msg []byte) any {
-	var req request.UpdateLotteryStatusReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionMgrHandler) UpdateLotteryStatus(session *remote.Session, req *request.UpdateLotteryStatusReq) any {
 	union := h.um.GetUnion(req.UnionID, h.redisService, h.userService, h.unionService)
 	if session.GetUid() != union.GetOwnerUid() {
 		return common.F(biz.RequestDataError)
 	}
 	union.UpdateLotteryStatus(req.IsOpen)
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	return common.S(nil)
 }
 
@@ -0,0 +1,230 @@
+package logic
+
+import (
+	"common"
+	"common/biz"
+	"common/logs"
+	"context"
+	"core/service"
+	"encoding/json"
+	"framework/msError"
+	"framework/remote"
+	"game/component/room"
+	"game/models/request"
+	"time"
+)
+
+// migrateWaitTimeOut 迁移中的房间收到消息时最多等待的时间
+const migrateWaitTimeOut = 10 * time.Second
+
+const importRoomRoute = "migrateHandler.importRoom"
+
+// importTimeOut 新的游戏服恢复房间的超时时间
+const importTimeOut = 5 * time.Second
+
+// MigrateRoom 将当前节点上的房间迁移到dst 玩家的消息会按房间的新归属转发 不需要重连
+func (u *UnionManager) MigrateRoom(session *remote.Session, roomId string, dst string, redisService *service.RedisService) *msError.Error {
+	data, err := u.ExportRoom(roomId)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), importTimeOut)
+	defer cancel()
+	res, err := session.Call(ctx, dst, importRoomRoute, &request.ImportRoomReq{
+		From:     session.GetServerId(),
+		Snapshot: data,
+	})
+	if err == nil {
+		err = parseMigrateResult(res)
+	}
+	if err != nil {
+		u.AbortExport(roomId, data, session, redisService)
+		return err
+	}
+	u.CompleteExport(roomId)
+	return nil
+}
+
+// MigrateRooms 停机时把房间轮流迁移到targets中的游戏服 超过timeout后不再迁移
+// 没有可用的游戏服或者迁移失败的房间留给Drain等待牌局结束后解散
+func (u *UnionManager) MigrateRooms(session *remote.Session, targets []string, timeout time.Duration, redisService *service.RedisService) {
+	if len(targets) == 0 {
+		logs.Warn("union manager no server to migrate rooms")
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	for i, r := range u.rooms() {
+		if !time.Now().Before(deadline) {
+			logs.Warn("union manager migrate rooms timeout")
+			return
+		}
+		dst := targets[i%len(targets)]
+		if err := u.MigrateRoom(session, r.Id, dst, redisService); err != nil {
+			logs.Error("union manager migrate room err:%v, roomId=%s, dst=%s", err, r.Id, dst)
+			continue
+		}
+		logs.Info("union manager migrated room %s to %s", r.Id, dst)
+	}
+}
+
+// parseMigrateResult 解析新游戏服返回的common.Result
+func parseMigrateResult(data []byte) *msError.Error {
+	var result common.Result
+	if err := json.Unmarshal(data, &result); err != nil {
+		return biz.RoomMigrateFail
+	}
+	if result.Code != biz.OK {
+		return msError.CodeError(result.Code, biz.RoomMigrateFail.Error())
+	}
+	return nil
+}
+
+// ExportRoom 迁移房间的第一步 冻结房间并返回快照 迁移结束前房间的消息会等待
+// 之后必须调用CompleteExport或者AbortExport
+func (u *UnionManager) ExportRoom(roomId string) ([]byte, *msError.Error) {
+	union := u.getUnionByRoomID(roomId)
+	if union == nil {
+		return nil, biz.RoomNotExist
+	}
+	union.RLock()
+	r := union.RoomList[roomId]
+	union.RUnlock()
+	//查找之后房间可能已经解散
+	if r == nil {
+		return nil, biz.RoomNotExist
+	}
+	u.Lock()
+	if _, ok := u.migrations[roomId]; ok || r.IsMigrating() {
+		u.Unlock()
+		return nil, biz.RoomMigrating
+	}
+	u.migrations[roomId] = make(chan struct{})
+	u.Unlock()
+	data, err := r.Freeze()
+	if err != nil {
+		logs.Error("union manager ExportRoom err:%v, roomId=%s", err, roomId)
+		u.AbortExport(roomId, nil, nil, nil)
+		return nil, biz.RoomMigrateFail
+	}
+	return data, nil
+}
+
+// CompleteExport 新的游戏服已经接管房间 从当前节点移除
+func (u *UnionManager) CompleteExport(roomId string) {
+	if union := u.getUnionByRoomID(roomId); union != nil {
+		union.Lock()
+		union.DestroyRoom(roomId)
+		union.Unlock()
+	}
+	u.finishMigration(roomId)
+}
+
+// AbortExport 迁移失败 根据冻结时的快照在当前节点恢复房间 data为空时只结束迁移状态
+// 调用超时时新的游戏服可能已经接管了房间 只有房间仍然属于当前节点时才恢复 否则按迁移完成处理
+func (u *UnionManager) AbortExport(roomId string, data []byte, session *remote.Session, redisService *service.RedisService) {
+	union := u.getUnionByRoomID(roomId)
+	if union == nil || data == nil {
+		u.finishMigration(roomId)
+		return
+	}
+	if !u.stillOwnRoom(redisService, roomId, session.GetServerId()) {
+		logs.Warn("union manager AbortExport room already imported, roomId=%s", roomId)
+		u.CompleteExport(roomId)
+		return
+	}
+	defer u.finishMigration(roomId)
+	s, err := room.ParseSnapshot(data)
+	if err == nil {
+		err = union.restoreRoom(s, session)
+	}
+	if err != nil {
+		logs.Error("union manager AbortExport restore err:%v, roomId=%s", err, roomId)
+	}
+}
+
+// stillOwnRoom 房间的归属和房间号都还属于serverId 读取失败时无法确认 当作已经被接管
+func (u *UnionManager) stillOwnRoom(redisService *service.RedisService, roomId string, serverId string) bool {
+	ctx := context.Background()
+	owner, err := redisService.Get(ctx, roomId)
+	if err != nil {
+		logs.Error("union manager stillOwnRoom get server err:%v, roomId=%s", err, roomId)
+		return false
+	}
+	if owner != serverId {
+		return false
+	}
+	idOwner, err := redisService.GetRoomIdOwner(ctx, roomId)
+	if err != nil {
+		logs.Error("union manager stillOwnRoom get room id owner err:%v, roomId=%s", err, roomId)
+		return false
+	}
+	return idOwner == "" || idOwner == serverId
+}
+
+// ImportRoom 迁移房间的第二步 在当前节点根据快照恢复房间 并将房间的归属从from改为当前节点
+func (u *UnionManager) ImportRoom(session *remote.Session,
+	data []byte,
+	from string,
+	redisService *service.RedisService,
+	userService *service.UserService,
+	unionService *service.UnionService) *msError.Error {
+	s, err := room.ParseSnapshot(data)
+	if err != nil {
+		logs.Error("union manager ImportRoom parse err:%v", err)
+		return biz.RoomMigrateFail
+	}
+	if u.GetRoomById(s.Id) != nil {
+		return biz.RoomMigrating
+	}
+	ctx := context.Background()
+	serverId := session.GetServerId()
+	ok, err := redisService.SwapRoomServer(ctx, s.Id, from, serverId)
+	if err != nil {
+		logs.Error("union manager ImportRoom SwapRoomServer err:%v, roomId=%s", err, s.Id)
+		return biz.SqlError
+	}
+	if !ok {
+		//房间已经不在from上 可能已经解散或者被其他流程接管
+		return biz.RoomMigrateFail
+	}
+	union := u.GetUnion(s.UnionID, redisService, userService, unionService)
+	err = u.claimRoomId(redisService, s.Id, from, serverId)
+	if err == nil {
+		err = union.restoreRoom(s, session)
+	}
+	if err != nil {
+		logs.Error("union manager ImportRoom restore err:%v, roomId=%s", err, s.Id)
+		redisService.SwapRoomServer(ctx, s.Id, serverId, from)
+		redisService.ClaimRoomId(ctx, s.Id, serverId, from)
+		return biz.RoomMigrateFail
+	}
+	if err := redisService.MoveRoomSnapshot(ctx, s.Id, from, serverId, data); err != nil {
+		logs.Error("union manager ImportRoom MoveRoomSnapshot err:%v, roomId=%s", err, s.Id)
+	}
+	logs.Info("union manager imported room %s from %s", s.Id, from)
+	return nil
+}
+
+// WaitMigration 房间正在迁移时等待迁移结束 之后再按房间的归属处理消息
+func (u *UnionManager) WaitMigration(roomId string) {
+	u.RLock()
+	done, ok := u.migrations[roomId]
+	u.RUnlock()
+	if !ok {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(migrateWaitTimeOut):
+		logs.Warn("union manager wait migration timeout, roomId=%s", roomId)
+	}
+}
+
+func (u *UnionManager) finishMigration(roomId string) {
+	u.Lock()
+	defer u.Unlock()
+	if done, ok := u.migrations[roomId]; ok {
+		close(done)
+		delete(u.migrations, roomId)
+	}
+}
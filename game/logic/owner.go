@@ -0,0 +1,110 @@
+package logic
+
+import (
+	"common/biz"
+	"common/logs"
+	"context"
+	"core/service"
+	"framework/msError"
+	"time"
+)
+
+// normalUnionId 普通房间所在的联盟 不需要归属 每个游戏服各自持有
+const normalUnionId = 1
+
+// unionOwnerRenewInterval 联盟归属续期的间隔 需要小于dao.UnionOwnerExpire
+const unionOwnerRenewInterval = 10 * time.Second
+
+// UnionOwner 联盟所在的游戏服 每个联盟只在一个游戏服上处理 避免多个节点上的数据不一致
+// 没有归属时由当前节点接管 新接管的联盟重新加载数据 之前作为房间所在节点留下的数据可能已经过期
+func (u *UnionManager) UnionOwner(redisService *service.RedisService, unionId int64, serverId string) (string, *msError.Error) {
+	if unionId == normalUnionId {
+		return serverId, nil
+	}
+	ctx := context.Background()
+	if u.IsDraining() {
+		//排空中不再接管联盟 转给其他游戏服
+		owner, err := redisService.GetUnionOwner(ctx, unionId)
+		if err != nil {
+			logs.Error("union manager GetUnionOwner err:%v, unionId=%d", err, unionId)
+			return "", biz.SqlError
+		}
+		if owner == "" || owner == serverId {
+			return "", biz.ServerDraining
+		}
+		return owner, nil
+	}
+	owner, err := redisService.AcquireUnionOwner(ctx, unionId, serverId)
+	if err != nil {
+		logs.Error("union manager AcquireUnionOwner err:%v, unionId=%d", err, unionId)
+		return "", biz.SqlError
+	}
+	if owner != serverId {
+		return owner, nil
+	}
+	u.Lock()
+	_, owned := u.owned[unionId]
+	u.owned[unionId] = struct{}{}
+	union := u.unionList[unionId]
+	u.Unlock()
+	if !owned {
+		logs.Info("union manager own union %d", unionId)
+		if union != nil {
+			union.reload()
+		}
+	}
+	return owner, nil
+}
+
+// KeepUnionOwners 定时续期当前节点持有的联盟 续期失败说明已经被其他游戏服接管 done关闭后退出
+func (u *UnionManager) KeepUnionOwners(redisService *service.RedisService, serverId string, done <-chan struct{}) {
+	ticker := time.NewTicker(unionOwnerRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if u.IsDraining() {
+			return
+		}
+		for _, unionId := range u.ownedUnions() {
+			owner, err := redisService.AcquireUnionOwner(context.Background(), unionId, serverId)
+			if err != nil {
+				logs.Error("union manager renew union owner err:%v, unionId=%d", err, unionId)
+				continue
+			}
+			if owner != serverId {
+				logs.Warn("union manager union %d is owned by %s", unionId, owner)
+				u.Lock()
+				delete(u.owned, unionId)
+				u.Unlock()
+			}
+		}
+	}
+}
+
+// ReleaseUnionOwners 停机排空时释放持有的联盟 之后的请求由其他游戏服接管
+func (u *UnionManager) ReleaseUnionOwners(redisService *service.RedisService, serverId string) {
+	//先标记排空 避免释放后又被当前节点接管
+	u.draining.Store(true)
+	for _, unionId := range u.ownedUnions() {
+		if err := redisService.ReleaseUnionOwner(context.Background(), unionId, serverId); err != nil {
+			logs.Error("union manager ReleaseUnionOwner err:%v, unionId=%d", err, unionId)
+		}
+	}
+	u.Lock()
+	u.owned = make(map[int64]struct{})
+	u.Unlock()
+}
+
+func (u *UnionManager) ownedUnions() []int64 {
+	u.RLock()
+	defer u.RUnlock()
+	ids := make([]int64, 0, len(u.owned))
+	for id := range u.owned {
+		ids = append(ids, id)
+	}
+	return ids
+}
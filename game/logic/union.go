@@ -5,6 +5,7 @@ import (
 	"common/logs"
 	"common/utils"
 	"context"
+	"core/dao"
 	"core/models/entity"
 	"core/models/enums"
 	"core/service"
@@ -35,6 +36,13 @@ type Union struct {
 }
 
 func (u *Union) DestroyRoom(roomId string) {
+	if r, ok := u.RoomList[roomId]; ok {
+		if !r.IsMigrating() {
+			//回收房间号 迁移走的房间号已经属于新的游戏服
+			u.m.ReleaseRoomId(u.redisService, roomId, r.GetServerId())
+		}
+		r.Close()
+	}
 	delete(u.RoomList, roomId)
 }
 func (u *Union) CreateRoom(redisService *service.RedisService, userService *service.UserService, session *remote.Session, req request.CreateRoomReq, userData *entity.User) *msError.Error {
@@ -67,7 +75,10 @@ func (u *Union) createRoom(req request.CreateRoomReq, uid string, session *remot
 	u.Lock()
 	defer u.Unlock()
 	//1. 需要创建一个房间 生成一个房间号
-	roomId := u.m.CreateRoomId()
+	roomId, err := u.m.CreateRoomId(u.redisService, session.GetServerId())
+	if err != nil {
+		return nil, err
+	}
 	gameRule := req.GameRule
 	if req.GameRuleID != "" {
 		gameRule = u.GetGameRule(req.GameRuleID)
@@ -82,12 +93,33 @@ func (u *Union) createRoom(req request.CreateRoomReq, uid string, session *remot
 	}
 	newRoom, err := room.NewRoom(roomId, creatorInfo, gameRule, u, session)
 	if err != nil {
+		u.m.ReleaseRoomId(u.redisService, roomId, session.GetServerId())
 		return nil, err
 	}
 	u.RoomList[roomId] = newRoom
 	return newRoom, nil
 }
 
+// restoreRoom 游戏服重启后根据快照恢复房间 并重新记录房间所在的游戏服
+func (u *Union) restoreRoom(s *room.Snapshot, session *remote.Session) error {
+	u.Lock()
+	defer u.Unlock()
+	r, err := room.RestoreRoom(s, u, session)
+	if err != nil {
+		return err
+	}
+	r.UserService = u.userService
+	r.RedisService = u.redisService
+	//迁移失败恢复时替换掉冻结的房间
+	if old, ok := u.RoomList[r.Id]; ok {
+		old.Close()
+	}
+	u.RoomList[r.Id] = r
+	//迁移过来的房间需要更新目录中所在的游戏服
+	r.UpdateDirectory()
+	return u.redisService.Store(r.Id, session.GetServerId())
+}
+
 func (u *Union) GetUnionInfo(uid string) entity.Union {
 	u.activeTime = time.Now()
 	unionData := *u.unionData
@@ -103,19 +135,78 @@ func (u *Union) init() {
 	}
 }
 
+// reload 联盟数据在其他节点或者hall被修改后 重新从数据库加载 加载失败时保留原来的数据
+func (u *Union) reload() {
+	if u.Id == 1 {
+		return
+	}
+	unionData := u.unionService.FindUnionById(u.Id)
+	if unionData == nil {
+		return
+	}
+	u.Lock()
+	u.unionData = unionData
+	u.Unlock()
+}
+
+// GetUnionRoomList 联盟在所有游戏服上的房间 本服的房间直接取最新的数据
 func (u *Union) GetUnionRoomList() []*proto.RoomInfo {
 	u.activeTime = time.Now()
-	var list []*proto.RoomInfo
-	for _, v := range u.RoomList {
-		roomInfo := v.GetRoomInfo()
-		list = append(list, roomInfo)
+	list := make([]*proto.RoomInfo, 0)
+	local := make(map[string]struct{}, len(u.RoomList))
+	for id, v := range u.RoomList {
+		if roomInfo := v.GetRoomInfo(); roomInfo != nil {
+			list = append(list, roomInfo)
+		}
+		local[id] = struct{}{}
 	}
-	if len(list) <= 0 {
-		list = []*proto.RoomInfo{}
+	for _, v := range u.directoryRooms() {
+		if _, ok := local[v.RoomId]; ok {
+			continue
+		}
+		var roomInfo proto.RoomInfo
+		if err := json.Unmarshal(v.Info, &roomInfo); err != nil {
+			logs.Error("GetUnionRoomList unmarshal room info err:%v, roomId=%s", err, v.RoomId)
+			continue
+		}
+		list = append(list, &roomInfo)
 	}
 	return list
 }
 
+// directoryRooms 联盟房间目录 读取失败时只使用本服的房间
+func (u *Union) directoryRooms() []*dao.UnionRoom {
+	if u.redisService == nil {
+		return nil
+	}
+	rooms, err := u.redisService.GetUnionRooms(context.Background(), u.Id)
+	if err != nil {
+		logs.Error("union GetUnionRooms err:%v, unionId=%d", err, u.Id)
+		return nil
+	}
+	return rooms
+}
+
+// FindRemoteRoom 快速加入时本服没有可以加入的房间 从目录中找其他游戏服上可以加入的房间
+// 返回房间号和所在的游戏服 都没有时返回空 由本服创建新的房间
+func (u *Union) FindRemoteRoom(gameRuleID string, serverId string) (string, string) {
+	for _, v := range u.RoomList {
+		if v.GameRule.Id == gameRuleID &&
+			v.CanEnter() && v.HasEmptyChair() {
+			return "", ""
+		}
+	}
+	for _, v := range u.directoryRooms() {
+		if v.ServerId == serverId || v.RuleId != gameRuleID {
+			continue
+		}
+		if v.Joinable && v.Seated < v.MaxPlayers {
+			return v.RoomId, v.ServerId
+		}
+	}
+	return "", ""
+}
+
 func (u *Union) QuickJoin(session *remote.Session, gameRuleID string, userInfo *entity.User) *msError.Error {
 	u.activeTime = time.Now()
 	var roomRuleItem *entity.RoomRule
@@ -136,7 +227,11 @@ func (u *Union) QuickJoin(session *remote.Session, gameRuleID string, userInfo *
 		}
 	}
 	//创建房间
-	roomId := u.m.CreateRoomId()
+	roomId, err := u.m.CreateRoomId(u.redisService, session.GetServerId())
+	if err != nil {
+		logs.Error("QuickJoin CreateRoomId err:%v", err)
+		return biz.Fail
+	}
 	creatorInfo := &proto.RoomCreator{
 		Uid:         userInfo.Uid,
 		CreatorType: enums.UserCreatorType,
@@ -146,9 +241,10 @@ func (u *Union) QuickJoin(session *remote.Session, gameRuleID string, userInfo *
 		creatorInfo.CreatorType = enums.UnionCreatorType
 	}
 	var gameRule proto.GameRule
-	err := json.Unmarshal([]byte(roomRuleItem.GameRule), &gameRule)
+	err = json.Unmarshal([]byte(roomRuleItem.GameRule), &gameRule)
 	if err != nil {
 		logs.Error("QuickJoin json.Unmarshal err:%v", err)
+		u.m.ReleaseRoomId(u.redisService, roomId, session.GetServerId())
 		return biz.Fail
 	}
 	gameRule.GameType = enums.GameType(roomRuleItem.GameType)
@@ -157,6 +253,7 @@ func (u *Union) QuickJoin(session *remote.Session, gameRuleID string, userInfo *
 	roomFrame, err := room.NewRoom(roomId, creatorInfo, gameRule, u, session)
 	if err != nil {
 		logs.Error("QuickJoin NewRoom err:%v", err)
+		u.m.ReleaseRoomId(u.redisService, roomId, session.GetServerId())
 		return biz.Fail
 	}
 	u.RoomList[roomId] = roomFrame
@@ -384,8 +481,11 @@ func (u *Union) GetLastActiveTime() time.Time {
 	return u.activeTime
 }
 
+// IsShouldDelete 没有房间并且超过t毫秒没有访问
 func (u *Union) IsShouldDelete(t int64) bool {
-	return len(u.RoomList) == 0 && u.activeTime.UnixMilli()-time.Now().UnixMilli() > t
+	u.RLock()
+	defer u.RUnlock()
+	return len(u.RoomList) == 0 && time.Now().UnixMilli()-u.activeTime.UnixMilli() > t
 }
 
 func (u *Union) UpdateUnionNotice(notice string) {
@@ -518,5 +618,6 @@ func NewUnion(m *UnionManager, unionID int64, unionService *service.UnionService
 		unionService: unionService,
 		redisService: redisService,
 		userService:  userService,
+		activeTime:   time.Now(),
 	}
 }
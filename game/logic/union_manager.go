@@ -2,25 +2,37 @@ package logic
 
 import (
 	"common/biz"
+	"common/logs"
+	"context"
 	"core/models/entity"
 	"core/service"
+	"errors"
 	"fmt"
 	"framework/msError"
 	"framework/remote"
 	"game/component/room"
 	"math/rand"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type UnionManager struct {
 	sync.RWMutex
 	unionList map[int64]*Union
+	draining  atomic.Bool
+	//迁移中的房间 迁移结束时关闭
+	migrations map[string]chan struct{}
+	//当前节点持有归属的联盟
+	owned map[int64]struct{}
 }
 
 func NewUnionManager() *UnionManager {
 	return &UnionManager{
-		unionList: make(map[int64]*Union),
+		unionList:  make(map[int64]*Union),
+		migrations: make(map[string]chan struct{}),
+		owned:      make(map[int64]struct{}),
 	}
 }
 
@@ -29,9 +41,10 @@ func (u *UnionManager) GetUnion(unionId int64,
 	userService *service.UserService,
 	unionService *service.UnionService) *Union {
 	u.Lock()
-	u.Unlock()
+	defer u.Unlock()
 	union, ok := u.unionList[unionId]
 	if ok {
+		union.activeTime = time.Now()
 		return union
 	}
 	union = NewUnion(u, unionId, unionService, redisService, userService)
@@ -40,20 +53,62 @@ func (u *UnionManager) GetUnion(unionId int64,
 	return union
 }
 
-func (u *UnionManager) CreateRoomId() string {
-	//随机数的方式去创建
-	roomId := u.genRoomId()
-	for _, v := range u.unionList {
-		_, ok := v.RoomList[roomId]
+// maxRoomIdRetry 随机的房间号已被占用时最多重试的次数
+const maxRoomIdRetry = 20
+
+// roomIdRenewInterval 房间号续期的间隔 需要小于dao.RoomIdExpire
+const roomIdRenewInterval = time.Minute
+
+// CreateRoomId 随机生成房间号并在redis中占用 保证集群内唯一 房间销毁后回收
+func (u *UnionManager) CreateRoomId(redisService *service.RedisService, serverId string) (string, error) {
+	for i := 0; i < maxRoomIdRetry; i++ {
+		//随机数的方式去创建
+		roomId := u.genRoomId()
+		ok, err := redisService.ReserveRoomId(context.Background(), roomId, serverId)
+		if err != nil {
+			return "", err
+		}
 		if ok {
-			return u.CreateRoomId()
+			return roomId, nil
+		}
+	}
+	return "", errors.New("no available room id")
+}
+
+// ReleaseRoomId 回收房间号 只会释放属于serverId的房间号 已经迁移走的房间不受影响
+func (u *UnionManager) ReleaseRoomId(redisService *service.RedisService, roomId string, serverId string) {
+	if err := redisService.ReleaseRoomId(context.Background(), roomId, serverId); err != nil {
+		logs.Error("union manager ReleaseRoomId err:%v, roomId=%s", err, roomId)
+	}
+}
+
+// KeepRoomIds 定时为当前节点上的房间续期房间号 游戏服宕机后房间号过期回收 done关闭后退出
+func (u *UnionManager) KeepRoomIds(redisService *service.RedisService, serverId string, done <-chan struct{}) {
+	ticker := time.NewTicker(roomIdRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		for _, r := range u.rooms() {
+			if r.IsMigrating() {
+				continue
+			}
+			ok, err := redisService.ClaimRoomId(context.Background(), r.Id, serverId, serverId)
+			if err != nil {
+				logs.Error("union manager renew room id err:%v, roomId=%s", err, r.Id)
+				continue
+			}
+			if !ok {
+				logs.Warn("union manager room id %s is owned by another server", r.Id)
+			}
 		}
 	}
-	return roomId
 }
 
 func (u *UnionManager) genRoomId() string {
-	rand.New(rand.NewSource(time.Now().UnixNano()))
 	//房间号是6位数
 	roomIdInt := rand.Int63n(999999)
 	if roomIdInt < 100000 {
@@ -63,8 +118,12 @@ func (u *UnionManager) genRoomId() string {
 }
 
 func (u *UnionManager) GetRoomById(roomId string) *room.Room {
+	u.RLock()
+	defer u.RUnlock()
 	for _, v := range u.unionList {
+		v.RLock()
 		r, ok := v.RoomList[roomId]
+		v.RUnlock()
 		if ok {
 			return r
 		}
@@ -88,11 +147,187 @@ func (u *UnionManager) IsUserInRoom(roomId string, uid string) bool {
 	return rooms.IsUserInRoom(uid)
 }
 
+// RoomCount 当前节点上的房间数 作为负载上报
+func (u *UnionManager) RoomCount() int {
+	u.RLock()
+	defer u.RUnlock()
+	count := 0
+	for _, v := range u.unionList {
+		v.RLock()
+		count += len(v.RoomList)
+		v.RUnlock()
+	}
+	return count
+}
+
+// GameStats 按游戏类型统计当前节点上的房间数和玩家数 用于监控
+func (u *UnionManager) GameStats() (map[string]float64, map[string]float64) {
+	rooms := make(map[string]float64)
+	players := make(map[string]float64)
+	for _, r := range u.rooms() {
+		gameType := strconv.Itoa(int(r.GameRule.GameType))
+		rooms[gameType]++
+		players[gameType] += float64(r.UserCount())
+	}
+	return rooms, players
+}
+
+// IsDraining 停机排空中 不再创建新的房间
+func (u *UnionManager) IsDraining() bool {
+	return u.draining.Load()
+}
+
+// Drain 停机时调用 不再创建新房间 等待进行中的牌局结束后解散房间 超过timeout后强制解散剩余的房间
+func (u *UnionManager) Drain(session *remote.Session, timeout time.Duration) {
+	u.draining.Store(true)
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		force := !time.Now().Before(deadline)
+		remaining := 0
+		for _, r := range u.rooms() {
+			if r.GetGameStarted() && !force {
+				remaining++
+				continue
+			}
+			r.DismissForShutdown(session)
+		}
+		if remaining == 0 {
+			logs.Info("union manager drained")
+			return
+		}
+		logs.Info("union manager draining, waiting for %d rooms", remaining)
+		<-ticker.C
+	}
+}
+
+// Restore 游戏服启动时恢复崩溃前保存了快照的房间 玩家重连后回到原来的牌局
+func (u *UnionManager) Restore(session *remote.Session,
+	redisService *service.RedisService,
+	userService *service.UserService,
+	unionService *service.UnionService) {
+	ctx := context.Background()
+	snapshots, err := redisService.LoadRoomSnapshots(ctx, session.GetServerId())
+	if err != nil {
+		logs.Error("union manager LoadRoomSnapshots err:%v", err)
+		return
+	}
+	for roomId, data := range snapshots {
+		s, err := room.ParseSnapshot(data)
+		if err == nil {
+			err = u.claimRoomId(redisService, roomId, session.GetServerId(), session.GetServerId())
+		}
+		if err == nil {
+			union := u.GetUnion(s.UnionID, redisService, userService, unionService)
+			err = union.restoreRoom(s, session)
+		}
+		if err != nil {
+			//无法恢复的快照直接删除 避免每次重启都失败
+			logs.Error("union manager restore room err:%v, roomId=%s", err, roomId)
+			redisService.DeleteRoomSnapshot(ctx, session.GetServerId(), roomId)
+			continue
+		}
+		logs.Info("union manager restored room %s", roomId)
+	}
+}
+
+// claimRoomId 续期或转移房间号 房间号已经分配给其他游戏服的房间时返回错误
+func (u *UnionManager) claimRoomId(redisService *service.RedisService, roomId string, from string, to string) error {
+	ok, err := redisService.ClaimRoomId(context.Background(), roomId, from, to)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("room id %s is owned by another server", roomId)
+	}
+	return nil
+}
+
+// rooms 当前节点上所有房间的快照
+func (u *UnionManager) rooms() []*room.Room {
+	u.RLock()
+	defer u.RUnlock()
+	rooms := make([]*room.Room, 0)
+	for _, v := range u.unionList {
+		v.RLock()
+		for _, r := range v.RoomList {
+			rooms = append(rooms, r)
+		}
+		v.RUnlock()
+	}
+	return rooms
+}
+
 func (u *UnionManager) getUnionByRoomID(roomId string) *Union {
+	u.RLock()
+	defer u.RUnlock()
 	for _, v := range u.unionList {
-		if v.RoomList[roomId] != nil {
+		v.RLock()
+		r := v.RoomList[roomId]
+		v.RUnlock()
+		if r != nil {
 			return v
 		}
 	}
 	return nil
 }
+
+// defaultUnionIdleTime 没有配置union.idleTime时 联盟空闲多久后从内存中移除
+const defaultUnionIdleTime = 30 * time.Minute
+
+// unionSweepInterval 检查空闲联盟的间隔
+const unionSweepInterval = time.Minute
+
+// SweepIdleUnions 定时移除没有房间并且长时间没有访问的联盟 释放持有的归属 再次访问时重新加载 done关闭后退出
+func (u *UnionManager) SweepIdleUnions(redisService *service.RedisService, serverId string, idle time.Duration, done <-chan struct{}) {
+	if idle <= 0 {
+		idle = defaultUnionIdleTime
+	}
+	ticker := time.NewTicker(unionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if u.IsDraining() {
+			return
+		}
+		for _, unionId := range u.evictIdleUnions(idle) {
+			if err := redisService.ReleaseUnionOwner(context.Background(), unionId, serverId); err != nil {
+				logs.Error("union manager ReleaseUnionOwner err:%v, unionId=%d", err, unionId)
+			}
+		}
+	}
+}
+
+// evictIdleUnions 返回被移除的联盟中当前节点持有归属的联盟
+func (u *UnionManager) evictIdleUnions(idle time.Duration) []int64 {
+	u.Lock()
+	defer u.Unlock()
+	owned := make([]int64, 0)
+	for id, v := range u.unionList {
+		if !v.IsShouldDelete(idle.Milliseconds()) {
+			continue
+		}
+		delete(u.unionList, id)
+		if _, ok := u.owned[id]; ok {
+			delete(u.owned, id)
+			owned = append(owned, id)
+		}
+		logs.Info("union manager evict idle union %d", id)
+	}
+	return owned
+}
+
+// ReloadUnion 联盟数据被修改后重新加载 当前节点上没有这个联盟时不需要处理
+func (u *UnionManager) ReloadUnion(unionId int64) {
+	u.RLock()
+	union, ok := u.unionList[unionId]
+	u.RUnlock()
+	if ok {
+		union.reload()
+	}
+}
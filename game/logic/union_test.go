@@ -0,0 +1,103 @@
+package logic
+
+import (
+	"common/config"
+	"common/logs"
+	"game/component/room"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUnionIsShouldDelete(t *testing.T) {
+	u := NewUnion(NewUnionManager(), 100, nil, nil, nil)
+	if u.IsShouldDelete(time.Minute.Milliseconds()) {
+		t.Fatal("new union should not be deleted")
+	}
+	u.activeTime = time.Now().Add(-2 * time.Minute)
+	if !u.IsShouldDelete(time.Minute.Milliseconds()) {
+		t.Fatal("idle union should be deleted")
+	}
+	u.RoomList["100001"] = &room.Room{}
+	if u.IsShouldDelete(time.Minute.Milliseconds()) {
+		t.Fatal("union with rooms should not be deleted")
+	}
+}
+
+func TestEvictIdleUnions(t *testing.T) {
+	config.Conf = new(config.Config)
+	logs.InitLog("logic")
+	m := NewUnionManager()
+	idle := NewUnion(m, 100, nil, nil, nil)
+	idle.activeTime = time.Now().Add(-time.Hour)
+	m.unionList[100] = idle
+	m.owned[100] = struct{}{}
+	m.unionList[200] = NewUnion(m, 200, nil, nil, nil)
+	owned := m.evictIdleUnions(time.Minute)
+	if len(owned) != 1 || owned[0] != 100 {
+		t.Fatalf("owned = %v, want [100]", owned)
+	}
+	if _, ok := m.unionList[100]; ok {
+		t.Fatal("idle union not evicted")
+	}
+	if _, ok := m.owned[100]; ok {
+		t.Fatal("evicted union still owned")
+	}
+	if _, ok := m.unionList[200]; !ok {
+		t.Fatal("active union evicted")
+	}
+}
+
+func TestTickersStopOnDone(t *testing.T) {
+	m := NewUnionManager()
+	done := make(chan struct{})
+	exited := make(chan struct{}, 3)
+	go func() { m.KeepRoomIds(nil, "game-001", done); exited <- struct{}{} }()
+	go func() { m.KeepUnionOwners(nil, "game-001", done); exited <- struct{}{} }()
+	go func() { m.SweepIdleUnions(nil, "game-001", time.Minute, done); exited <- struct{}{} }()
+	close(done)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.Fatal("ticker goroutine not stopped after done closed")
+		}
+	}
+}
+
+func TestGetRoomByIdDuringSweep(t *testing.T) {
+	config.Conf = &config.Config{Log: config.LogConf{Level: "error"}}
+	logs.InitLog("logic")
+	m := NewUnionManager()
+	active := NewUnion(m, 1, nil, nil, nil)
+	active.RoomList["100001"] = &room.Room{}
+	m.unionList[1] = active
+	var rounds atomic.Int64
+	stop := make(chan struct{})
+	swept := make(chan struct{})
+	go func() {
+		defer close(swept)
+		for i := int64(100); ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			idle := NewUnion(m, i, nil, nil, nil)
+			idle.activeTime = time.Now().Add(-time.Hour)
+			m.Lock()
+			m.unionList[i] = idle
+			m.Unlock()
+			m.evictIdleUnions(time.Minute)
+			rounds.Add(1)
+		}
+	}()
+	//清理协程跑过足够多轮之后再停止 保证查询和清理交错执行
+	for i := 0; i < 1000 || rounds.Load() < 200; i++ {
+		if m.GetRoomById("100001") == nil || m.getUnionByRoomID("100001") != active {
+			t.Fatal("room not found during sweep")
+		}
+	}
+	close(stop)
+	<-swept
+}
@@ -0,0 +1,11 @@
+package request
+
+type MigrateRoomReq struct {
+	RoomID string `json:"roomID"`
+	Dst    string `json:"dst"` //迁移到的游戏服
+}
+
+type ImportRoomReq struct {
+	From     string `json:"from"`
+	Snapshot []byte `json:"snapshot"`
+}
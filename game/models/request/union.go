@@ -13,13 +13,18 @@ type JoinRoomReq struct {
 }
 
 type GetUnionReq struct {
-	UnionID int64 `json:"unionID"`
+	UnionID int64 `json:"unionID" validate:"gt=0"`
 }
 type QuickJoinReq struct {
-	UnionID    int64  `json:"unionID"`
+	UnionID    int64  `json:"unionID" validate:"gt=0"`
 	GameRuleID string `json:"gameRuleID"`
 }
 
-type HoneBaoReq struct {
+// UnionChangedReq hall或其他game节点修改联盟数据后的广播
+type UnionChangedReq struct {
 	UnionID int64 `json:"unionID"`
 }
+
+type HoneBaoReq struct {
+	UnionID int64 `json:"unionID" validate:"gt=0"`
+}
@@ -26,23 +26,23 @@ type UpdateOpeningStatusReq struct {
 	IsOpen  bool  `json:"isOpen"`
 }
 type UpdateUnionNoticeReq struct {
-	UnionID int64  `json:"unionID"`
+	UnionID int64  `json:"unionID" validate:"gt=0"`
 	Notice  string `json:"notice"`
 }
 type UpdateUnionNameReq struct {
-	UnionID   int64  `json:"unionID"`
+	UnionID   int64  `json:"unionID" validate:"gt=0"`
 	UnionName string `json:"unionName"`
 }
 type UpdatePartnerNoticeSwitchReq struct {
-	UnionID int64 `json:"unionID"`
+	UnionID int64 `json:"unionID" validate:"gt=0"`
 	IsOpen  bool  `json:"isOpen"`
 }
 type DismissRoomReq struct {
-	UnionID int64  `json:"unionID"`
+	UnionID int64  `json:"unionID" validate:"gt=0"`
 	RoomID  string `json:"roomID"`
 }
 type HongBaoSettingReq struct {
-	UnionID    int64 `json:"unionID"`
+	UnionID    int64 `json:"unionID" validate:"gt=0"`
 	Status     bool  `json:"status"`
 	StartTime  int64 `json:"startTime"`
 	EndTime    int64 `json:"endTime"`
@@ -50,6 +50,6 @@ type HongBaoSettingReq struct {
 	TotalScore int64 `json:"totalScore"`
 }
 type UpdateLotteryStatusReq struct {
-	UnionID int64 `json:"unionID"`
+	UnionID int64 `json:"unionID" validate:"gt=0"`
 	IsOpen  bool  `json:"isOpen"`
 }
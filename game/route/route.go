@@ -7,29 +7,35 @@ import (
 	"game/logic"
 )
 
-func Register(r *repo.Manager) node.LogicHandler {
+func Register(r *repo.Manager, um *logic.UnionManager) node.LogicHandler {
 	handlers := make(node.LogicHandler)
-	um := logic.NewUnionManager()
 	unionHandler := handler.NewUnionHandler(r, um)
-	handlers["unionHandler.createRoom"] = unionHandler.CreateRoom
-	handlers["unionHandler.joinRoom"] = unionHandler.JoinRoom
-	handlers["unionHandler.getUnionInfo"] = unionHandler.GetUnionInfo
-	handlers["unionHandler.getUnionRoomList"] = unionHandler.GetUnionRoomList
-	handlers["unionHandler.quickJoin"] = unionHandler.QuickJoin
-	handlers["unionHandler.getHongBao"] = unionHandler.GetHongBao
+	node.Handle(handlers, "unionHandler.createRoom", unionHandler.CreateRoom, node.DispatchByUid)
+	node.Handle(handlers, "unionHandler.joinRoom", unionHandler.JoinRoom, node.DispatchByUid)
+	node.Handle(handlers, "unionHandler.getUnionInfo", unionHandler.GetUnionInfo)
+	node.Handle(handlers, "unionHandler.getUnionRoomList", unionHandler.GetUnionRoomList)
+	node.Handle(handlers, "unionHandler.quickJoin", unionHandler.QuickJoin, node.DispatchByUid)
+	node.Handle(handlers, "unionHandler.getHongBao", unionHandler.GetHongBao)
+	//service.UnionChangedRoute 联盟数据变化的广播
+	node.Handle(handlers, "unionHandler.unionChanged", unionHandler.UnionChanged)
 	unionMgrHandler := handler.NewUnionMgrHandler(r, um)
-	handlers["unionMgrHandler.addRoomRuleList"] = unionMgrHandler.AddRoomRuleList
-	handlers["unionMgrHandler.updateRoomRuleList"] = unionMgrHandler.UpdateRoomRuleList
-	handlers["unionMgrHandler.removeRoomRuleList"] = unionMgrHandler.RemoveRoomRuleList
-	handlers["unionMgrHandler.updateOpeningStatus"] = unionMgrHandler.UpdateOpeningStatus
-	handlers["unionMgrHandler.updateUnionNotice"] = unionMgrHandler.UpdateUnionNotice
-	handlers["unionMgrHandler.updateUnionName"] = unionMgrHandler.UpdateUnionName
-	handlers["unionMgrHandler.updatePartnerNoticeSwitch"] = unionMgrHandler.UpdatePartnerNoticeSwitch
-	handlers["unionMgrHandler.dismissRoom"] = unionMgrHandler.DismissRoom
-	handlers["unionMgrHandler.hongBaoSetting"] = unionMgrHandler.HongBaoSetting
-	handlers["unionMgrHandler.updateLotteryStatus"] = unionMgrHandler.UpdateLotteryStatus
+	node.Handle(handlers, "unionMgrHandler.addRoomRuleList", unionMgrHandler.AddRoomRuleList)
+	node.Handle(handlers, "unionMgrHandler.updateRoomRuleList", unionMgrHandler.UpdateRoomRuleList)
+	node.Handle(handlers, "unionMgrHandler.removeRoomRuleList", unionMgrHandler.RemoveRoomRuleList)
+	node.Handle(handlers, "unionMgrHandler.updateOpeningStatus", unionMgrHandler.UpdateOpeningStatus)
+	node.Handle(handlers, "unionMgrHandler.updateUnionNotice", unionMgrHandler.UpdateUnionNotice)
+	node.Handle(handlers, "unionMgrHandler.updateUnionName", unionMgrHandler.UpdateUnionName)
+	node.Handle(handlers, "unionMgrHandler.updatePartnerNoticeSwitch", unionMgrHandler.UpdatePartnerNoticeSwitch)
+	node.Handle(handlers, "unionMgrHandler.dismissRoom", unionMgrHandler.DismissRoom)
+	node.Handle(handlers, "unionMgrHandler.hongBaoSetting", unionMgrHandler.HongBaoSetting)
+	node.Handle(handlers, "unionMgrHandler.updateLotteryStatus", unionMgrHandler.UpdateLotteryStatus)
 	gameHandler := handler.NewGameHandler(r, um)
-	handlers["gameHandler.roomMessageNotify"] = gameHandler.RoomMessageNotify
-	handlers["gameHandler.gameMessageNotify"] = gameHandler.GameMessageNotify
+	//同一个房间的消息按顺序处理 避免出牌、托管等操作乱序
+	node.Handle(handlers, "gameHandler.roomMessageNotify", gameHandler.RoomMessageNotify, node.DispatchByRoom)
+	handlers.Register("gameHandler.gameMessageNotify", gameHandler.GameMessageNotify, node.DispatchByRoom)
+	migrateHandler := handler.NewMigrateHandler(r, um)
+	//滚动发布时将房间迁移到其他游戏服 只接受节点之间的rpc调用
+	node.Handle(handlers, "migrateHandler.migrateRoom", migrateHandler.MigrateRoom)
+	node.Handle(handlers, "migrateHandler.importRoom", migrateHandler.ImportRoom)
 	return handlers
 }
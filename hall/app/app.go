@@ -1,10 +1,15 @@
 package app
 
 import (
+	"common"
+	"common/biz"
 	"common/config"
 	"common/logs"
+	"common/metrics"
+	"common/trace"
 	"context"
 	"core/repo"
+	"core/service"
 	"framework/node"
 	"hall/route"
 	"os"
@@ -13,21 +18,38 @@ import (
 	"time"
 )
 
+// NewNode 创建注册好路由和中间件的节点 单进程模式也使用
+func NewNode(manager *repo.Manager) *node.App {
+	n := node.Default()
+	n.RegisterHandler(route.Register(manager))
+	//踢人时根据在线注册表找到用户所在的connector
+	n.SetOnlineLookup(service.NewOnlineService(manager).ConnectorId)
+	//协程池的运行状态
+	n.RegisterPoolGauges("hall")
+	//耗时统计放在最外层 包括其他中间件的耗时
+	n.Use(node.Metrics(metrics.ObserveHandler), node.Recovery(), node.Logger(), node.Auth(common.F(biz.InvalidUsers)))
+	return n
+}
+
 func Run(ctx context.Context, serverId string) error {
 	//1.做一个日志库 info error fatal debug
 	logs.InitLog(config.Conf.AppName)
+	shutdownTrace, err := trace.Init(config.Conf.AppName, config.Conf.Trace)
+	if err != nil {
+		logs.Error("init trace err:%v", err)
+		return err
+	}
 	exit := func() {}
 	go func() {
-		n := node.Default()
+		n := NewNode(repo.New())
 		exit = n.Close
-		manager := repo.New()
-		n.RegisterHandler(route.Register(manager))
 		n.Run(serverId)
 	}()
 	stop := func() {
 		//other
 		exit()
 		time.Sleep(3 * time.Second)
+		shutdownTrace()
 		logs.Info("stop app finish")
 	}
 	//期望有一个优雅启停 遇到中断 退出 终止 挂断
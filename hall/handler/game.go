@@ -2,11 +2,9 @@ package handler
 
 import (
 	"common"
-	"common/biz"
 	"core/dao"
 	"core/repo"
 	"core/service"
-	"encoding/json"
 	"framework/remote"
 	"hall/models/request"
 )
@@ -16,12 +14,8 @@ type GameHandler struct {
 	redisService *service.RedisService
 }
 
-func (h *GameHandler) JoinRoom(session *remote.Session, msg []byte) any {
+func (h *GameHandler) JoinRoom(session *remote.Session, req *request.JoinRoomReq) any {
 	//uid := session.GetUid()
-	var req request.JoinRoomReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
 	//找到game服务器进行调用
 	if err := Dispatch(h.redisService, session, req.RoomId, "unionHandler.joinRoom"); err != nil {
 		return common.F(err)
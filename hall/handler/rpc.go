@@ -3,7 +3,6 @@ package handler
 import (
 	"common/biz"
 	"common/logs"
-	"context"
 	"core/service"
 	"framework/msError"
 	"framework/remote"
@@ -14,7 +13,7 @@ func Dispatch(
 	session *remote.Session,
 	roomId string,
 	router string) *msError.Error {
-	server, err := redisService.Get(context.TODO(), roomId)
+	server, err := redisService.Get(session.Context(), roomId)
 	if err != nil {
 		return biz.SqlError
 	}
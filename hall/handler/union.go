@@ -11,7 +11,6 @@ import (
 	"core/models/enums"
 	"core/repo"
 	"core/service"
-	"encoding/json"
 	"fmt"
 	"framework/game"
 	"framework/remote"
@@ -25,25 +24,22 @@ import (
 )
 
 type UnionHandler struct {
-	redisDao    *dao.RedisDao
-	userDao     *dao.UserDao
-	unionDao    *dao.UnionDao
-	recordDao   *dao.RecordDao
-	commonDao   *dao.CommonDao
-	userService *service.UserService
+	redisDao     *dao.RedisDao
+	userDao      *dao.UserDao
+	unionDao     *dao.UnionDao
+	recordDao    *dao.RecordDao
+	commonDao    *dao.CommonDao
+	userService  *service.UserService
+	unionService *service.UnionService
 }
 
 // CreateUnion 创建联盟
-func (h *UnionHandler) CreateUnion(session *remote.Session, msg []byte) any {
-	var req request.CreateUnionReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) CreateUnion(session *remote.Session, req *request.CreateUnionReq) any {
 	//长度限制一下
 	if len(req.UnionName) > 60 {
 		return common.F(biz.RequestDataError)
 	}
-	user, err := h.userDao.FindUserByUid(context.TODO(), session.GetUid())
+	user, err := h.userDao.FindUserByUid(session.Context(), session.GetUid())
 	if err != nil {
 		return common.F(biz.InvalidUsers)
 	}
@@ -128,14 +124,7 @@ func (h *UnionHandler) CreateUnion(session *remote.Session, msg []byte) any {
 }
 
 // JoinUnion 加入联盟
-func (h *UnionHandler) JoinUnion(session *remote.Session, msg []byte) any {
-	var req request.JoinUnionReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.InviteID == "" {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) JoinUnion(session *remote.Session, req *request.JoinUnionReq) any {
 	inviteID, _ := strconv.ParseInt(req.InviteID, 10, 64)
 	inviteUserData, err := h.userDao.FindUserByInviteID(context.Background(), inviteID)
 	if err != nil {
@@ -182,6 +171,7 @@ func (h *UnionHandler) JoinUnion(session *remote.Session, msg []byte) any {
 		logs.Error("[UnionHandler] JoinUnion update union curMember err:%v", err)
 		return common.F(biz.SqlError)
 	}
+	h.unionService.NotifyUnionChanged(inviteUnionInfo.UnionID, session)
 	addUnionInfo := entity.UnionInfo{
 		UnionID:    inviteUnionInfo.UnionID,
 		SpreaderID: inviteUserData.Uid,
@@ -214,14 +204,7 @@ func (h *UnionHandler) JoinUnion(session *remote.Session, msg []byte) any {
 }
 
 // ExitUnion 退出联盟
-func (h *UnionHandler) ExitUnion(session *remote.Session, msg []byte) any {
-	var req request.ExitUnionReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) ExitUnion(session *remote.Session, req *request.ExitUnionReq) any {
 	union, err := h.unionDao.FindUnionByUnionID(context.Background(), req.UnionID)
 	if err != nil {
 		logs.Error("[UnionHandler] ExitUnion find union err:%v", err)
@@ -296,6 +279,7 @@ func (h *UnionHandler) ExitUnion(session *remote.Session, msg []byte) any {
 		logs.Error("[UnionHandler] ExitUnion update union curMember err:%v", err)
 		return common.F(biz.SqlError)
 	}
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	res := &response.ExitUnionResp{
 		Code: biz.OK,
 		UpdateUserData: map[string]any{
@@ -308,10 +292,7 @@ func (h *UnionHandler) ExitUnion(session *remote.Session, msg []byte) any {
 // GetUserUnionList 获取用户联盟列表
 func (h *UnionHandler) GetUserUnionList(session *remote.Session, msg []byte) any {
 	uid := session.GetUid()
-	if uid == "" {
-		return common.F(biz.InvalidUsers)
-	}
-	user, err := h.userDao.FindUserByUid(context.TODO(), uid)
+	user, err := h.userDao.FindUserByUid(session.Context(), uid)
 	if err != nil {
 		return common.F(biz.InvalidUsers)
 	}
@@ -347,14 +328,7 @@ func (h *UnionHandler) GetUserUnionList(session *remote.Session, msg []byte) any
 }
 
 // GetMemberList 获取成员列表
-func (h *UnionHandler) GetMemberList(session *remote.Session, msg []byte) any {
-	var req request.MemberListReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GetMemberList(session *remote.Session, req *request.MemberListReq) any {
 	list, total, err := h.userDao.FindUserPage(context.Background(), req.StartIndex, req.Count, bson.M{
 		"roomID":          -1,
 		"frontendId":      -1,
@@ -411,14 +385,7 @@ func (h *UnionHandler) GetMemberList(session *remote.Session, msg []byte) any {
 }
 
 // GetMemberStatisticsInfo 统计
-func (h *UnionHandler) GetMemberStatisticsInfo(session *remote.Session, msg []byte) any {
-	var req request.MemberStatisticsInfoReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GetMemberStatisticsInfo(session *remote.Session, req *request.MemberStatisticsInfoReq) any {
 	pipeline := mongo.Pipeline{
 		// Unwind the unionInfo array
 		{{"$unwind", "$unionInfo"}},
@@ -453,14 +420,7 @@ func (h *UnionHandler) GetMemberStatisticsInfo(session *remote.Session, msg []by
 }
 
 // GetMemberScoreList 获取成员列表
-func (h *UnionHandler) GetMemberScoreList(session *remote.Session, msg []byte) any {
-	var req request.MemberScoreReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GetMemberScoreList(session *remote.Session, req *request.MemberScoreReq) any {
 	list, total, err := h.userDao.FindUserPage(context.Background(), req.StartIndex, req.Count, bson.M{
 		"unionInfo.score": -1,
 	}, req.MatchData)
@@ -516,14 +476,7 @@ func (h *UnionHandler) GetMemberScoreList(session *remote.Session, msg []byte) a
 }
 
 // SafeBoxOperation 保险柜操作
-func (h *UnionHandler) SafeBoxOperation(session *remote.Session, msg []byte) any {
-	var req request.SafeBoxOperation
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) SafeBoxOperation(session *remote.Session, req *request.SafeBoxOperation) any {
 	userData, err := h.userDao.GetUnlockUserDataAndLock(context.Background(), session.GetUid())
 	if err != nil {
 		return common.F(biz.SqlError)
@@ -621,14 +574,7 @@ func (h *UnionHandler) SafeBoxOperation(session *remote.Session, msg []byte) any
 const WEEK_MS = 7 * 24 * time.Hour
 
 // SafeBoxOperationRecord 保险箱操作记录
-func (h *UnionHandler) SafeBoxOperationRecord(session *remote.Session, msg []byte) any {
-	var req request.SafeBoxOperation
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) SafeBoxOperationRecord(session *remote.Session, req *request.SafeBoxOperation) any {
 	now := time.Now().UnixMilli()
 
 	matchData := bson.M{
@@ -656,14 +602,7 @@ func (h *UnionHandler) SafeBoxOperationRecord(session *remote.Session, msg []byt
 }
 
 // ModifyScore 修改积分 count > 0 加分 count < 0 减分
-func (h *UnionHandler) ModifyScore(session *remote.Session, msg []byte) any {
-	var req request.ModifyScoreReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.UnionID <= 0 || req.MemberUid == "" || req.Count <= 0 {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) ModifyScore(session *remote.Session, req *request.ModifyScoreReq) any {
 	unionData, err := h.unionDao.FindUnionByUnionID(context.Background(), req.UnionID)
 	if err != nil {
 		return common.F(biz.SqlError)
@@ -863,14 +802,7 @@ func (h *UnionHandler) ModifyScore(session *remote.Session, msg []byte) any {
 }
 
 // AddPartner 添加合伙人
-func (h *UnionHandler) AddPartner(session *remote.Session, msg []byte) any {
-	var req request.AddPartnerReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	if req.MemberUid == "" {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) AddPartner(session *remote.Session, req *request.AddPartnerReq) any {
 	unionData, err := h.unionDao.FindUnionByUnionID(context.Background(), req.UnionID)
 	if err != nil {
 		logs.Error("[UnionHandler] AddPartner find union err:%v", err)
@@ -941,11 +873,7 @@ func (h *UnionHandler) AddPartner(session *remote.Session, msg []byte) any {
 }
 
 // GetScoreModifyRecord 查看修改积分日志
-func (h *UnionHandler) GetScoreModifyRecord(session *remote.Session, msg []byte) any {
-	var req request.GetScoreModifyRecordReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GetScoreModifyRecord(session *remote.Session, req *request.GetScoreModifyRecordReq) any {
 	recordPage, total, err := h.recordDao.FindScoreModifyRecordPage(
 		context.Background(),
 		req.StartIndex,
@@ -1045,11 +973,7 @@ func (h *UnionHandler) GetScoreModifyRecord(session *remote.Session, msg []byte)
 }
 
 // InviteJoinUnion 邀请玩家
-func (h *UnionHandler) InviteJoinUnion(session *remote.Session, msg []byte) any {
-	var req request.InviteJoinUnionReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) InviteJoinUnion(session *remote.Session, req *request.InviteJoinUnionReq) any {
 	unionData, err := h.unionDao.FindUnionByUnionID(context.Background(), req.UnionID)
 	if err != nil {
 		logs.Error("[UnionHandler] InviteJoinUnion find union err:%v", err)
@@ -1115,6 +1039,7 @@ func (h *UnionHandler) InviteJoinUnion(session *remote.Session, msg []byte) any
 		logs.Error("[UnionHandler] InviteJoinUnion find and update err:%v", err)
 		return common.F(biz.SqlError)
 	}
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	pushData := entity.UnionInfo{
 		UnionID:    req.UnionID,
 		SpreaderID: session.GetUid(),
@@ -1147,11 +1072,7 @@ func (h *UnionHandler) InviteJoinUnion(session *remote.Session, msg []byte) any
 }
 
 // OperationInviteJoinUnion 操作俱乐部邀请
-func (h *UnionHandler) OperationInviteJoinUnion(session *remote.Session, msg []byte) any {
-	var req request.OperationInviteJoinUnionReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) OperationInviteJoinUnion(session *remote.Session, req *request.OperationInviteJoinUnionReq) any {
 	userData, err := h.userDao.FindUserByUid(context.Background(), session.GetUid())
 	if err != nil {
 		logs.Error("[UnionHandler] OperationInviteJoinUnion find user err:%v", err)
@@ -1282,6 +1203,7 @@ func (h *UnionHandler) OperationInviteJoinUnion(session *remote.Session, msg []b
 		logs.Error("[UnionHandler] OperationInviteJoinUnion find and update err:%v", err)
 		return common.F(biz.SqlError)
 	}
+	h.unionService.NotifyUnionChanged(req.UnionID, session)
 	// 加入到联盟中
 	pushData := entity.UnionInfo{
 		UnionID:    req.UnionID,
@@ -1322,11 +1244,7 @@ func (h *UnionHandler) OperationInviteJoinUnion(session *remote.Session, msg []b
 }
 
 // UpdateUnionRebate 更新返利比例
-func (h *UnionHandler) UpdateUnionRebate(session *remote.Session, msg []byte) any {
-	var req request.UpdateUnionRebateReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) UpdateUnionRebate(session *remote.Session, req *request.UpdateUnionRebateReq) any {
 	if req.MemberUid != "" || req.RebateRate > 1 || req.RebateRate < 0 {
 		return common.F(biz.RequestDataError)
 	}
@@ -1404,11 +1322,7 @@ func (h *UnionHandler) UpdateUnionRebate(session *remote.Session, msg []byte) an
 }
 
 // UpdateUnionNotice 更新通知
-func (h *UnionHandler) UpdateUnionNotice(session *remote.Session, msg []byte) any {
-	var req request.UpdateUnionNoticeReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) UpdateUnionNotice(session *remote.Session, req *request.UpdateUnionNoticeReq) any {
 	if len(req.Notice) > 120 {
 		return common.F(biz.RequestDataError)
 	}
@@ -1432,11 +1346,7 @@ func (h *UnionHandler) UpdateUnionNotice(session *remote.Session, msg []byte) an
 }
 
 // GiveScore 赠送积分
-func (h *UnionHandler) GiveScore(session *remote.Session, msg []byte) any {
-	var req request.GiveScoreReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GiveScore(session *remote.Session, req *request.GiveScoreReq) any {
 	if req.Count <= 0 || req.GiveUid == session.GetUid() {
 		return common.F(biz.RequestDataError)
 	}
@@ -1594,11 +1504,7 @@ func (h *UnionHandler) GiveScore(session *remote.Session, msg []byte) any {
 }
 
 // GetGiveScoreRecord 赠送积分
-func (h *UnionHandler) GetGiveScoreRecord(session *remote.Session, msg []byte) any {
-	var req request.GetGiveScoreRecordReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GetGiveScoreRecord(session *remote.Session, req *request.GetGiveScoreRecordReq) any {
 	var list []entity.ScoreGiveRecord
 	total, err := h.commonDao.FindDataAndCount(
 		context.Background(),
@@ -1677,11 +1583,7 @@ func (h *UnionHandler) GetGiveScoreRecord(session *remote.Session, msg []byte) a
 }
 
 // GetUnionRebateRecord 获取成员列表
-func (h *UnionHandler) GetUnionRebateRecord(session *remote.Session, msg []byte) any {
-	var req request.GetUnionRebateRecordReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GetUnionRebateRecord(session *remote.Session, req *request.GetUnionRebateRecordReq) any {
 	var list []*entity.UserRebateRecord
 	total, err := h.commonDao.FindDataAndCount(
 		context.Background(),
@@ -1702,12 +1604,8 @@ func (h *UnionHandler) GetUnionRebateRecord(session *remote.Session, msg []byte)
 }
 
 // GetGameRecord 获取记录
-func (h *UnionHandler) GetGameRecord(session *remote.Session, msg []byte) any {
-	var req request.GetGameRecordReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	list, total, err := h.recordDao.FindUserGameRecordPage(context.TODO(), req.StartIndex, req.Count, bson.M{"createTime": -1}, req.MatchData)
+func (h *UnionHandler) GetGameRecord(session *remote.Session, req *request.GetGameRecordReq) any {
+	list, total, err := h.recordDao.FindUserGameRecordPage(session.Context(), req.StartIndex, req.Count, bson.M{"createTime": -1}, req.MatchData)
 	if err != nil {
 		logs.Error("[UnionHandler] GetGameRecord err:%v", err)
 		return common.F(biz.SqlError)
@@ -1723,11 +1621,7 @@ func (h *UnionHandler) GetGameRecord(session *remote.Session, msg []byte) any {
 }
 
 // GetVideoRecord 获取游戏录像
-func (h *UnionHandler) GetVideoRecord(session *remote.Session, msg []byte) any {
-	var req request.GetVideoRecordReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GetVideoRecord(session *remote.Session, req *request.GetVideoRecordReq) any {
 	matchData := bson.M{
 		"videoRecordID": req.VideoRecordID,
 	}
@@ -1745,11 +1639,7 @@ func (h *UnionHandler) GetVideoRecord(session *remote.Session, msg []byte) any {
 }
 
 // UpdateForbidGameStatus 更新禁止游戏状态
-func (h *UnionHandler) UpdateForbidGameStatus(session *remote.Session, msg []byte) any {
-	var req request.UpdateForbidGameStatusReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) UpdateForbidGameStatus(session *remote.Session, req *request.UpdateForbidGameStatusReq) any {
 	var unionData *entity.Union
 	err := h.commonDao.FindOneData(context.Background(), "union", bson.M{
 		"unionID": req.UnionID,
@@ -1762,7 +1652,7 @@ func (h *UnionHandler) UpdateForbidGameStatus(session *remote.Session, msg []byt
 		return common.F(biz.RequestDataError)
 	}
 	// 查询用户数据
-	userData, err := h.userDao.FindUserByUid(context.TODO(), session.GetUid())
+	userData, err := h.userDao.FindUserByUid(session.Context(), session.GetUid())
 	if err != nil {
 		logs.Error("[UnionHandler] UpdateForbidGameStatus err:%v", err)
 		return common.F(biz.SqlError)
@@ -1782,7 +1672,7 @@ func (h *UnionHandler) UpdateForbidGameStatus(session *remote.Session, msg []byt
 	if unionItem.ProhibitGame == req.Forbid {
 		return common.S(nil)
 	}
-	newUserData, err := h.userDao.FindAndUpdate(context.TODO(), bson.M{"uid": session.GetUid(), "unionInfo.unionID": req.UnionID}, bson.M{"unionInfo.$.prohibitGame": req.Forbid})
+	newUserData, err := h.userDao.FindAndUpdate(session.Context(), bson.M{"uid": session.GetUid(), "unionInfo.unionID": req.UnionID}, bson.M{"unionInfo.$.prohibitGame": req.Forbid})
 	if err != nil {
 		logs.Error("[UnionHandler] UpdateForbidGameStatus err:%v", err)
 		return common.F(biz.SqlError)
@@ -1796,13 +1686,9 @@ func (h *UnionHandler) UpdateForbidGameStatus(session *remote.Session, msg []byt
 }
 
 // GetRank 排名
-func (h *UnionHandler) GetRank(session *remote.Session, msg []byte) any {
-	var req request.GetRankReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GetRank(session *remote.Session, req *request.GetRankReq) any {
 	// 查询联盟数据
-	unionData, err := h.unionDao.FindUnionByUnionID(context.TODO(), req.UnionID)
+	unionData, err := h.unionDao.FindUnionByUnionID(session.Context(), req.UnionID)
 	if err != nil {
 		logs.Error("[UnionHandler] GetRank err:%v", err)
 		return common.F(biz.SqlError)
@@ -1859,13 +1745,9 @@ func (h *UnionHandler) GetRank(session *remote.Session, msg []byte) any {
 }
 
 // GetRankSingleDraw
-func (h *UnionHandler) GetRankSingleDraw(session *remote.Session, msg []byte) any {
-	var req request.GetRankSingleDrawReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UnionHandler) GetRankSingleDraw(session *remote.Session, req *request.GetRankSingleDrawReq) any {
 	// 查询联盟数据
-	unionData, err := h.unionDao.FindUnionByUnionID(context.TODO(), req.UnionID)
+	unionData, err := h.unionDao.FindUnionByUnionID(session.Context(), req.UnionID)
 	if err != nil {
 		logs.Error("[UnionHandler] GetRankSingleDraw err:%v", err)
 		return common.F(biz.SqlError)
@@ -1936,11 +1818,12 @@ func (h *UnionHandler) GetRankSingleDraw(session *remote.Session, msg []byte) an
 
 func NewUnionHandler(r *repo.Manager) *UnionHandler {
 	return &UnionHandler{
-		redisDao:    dao.NewRedisDao(r),
-		userDao:     dao.NewUserDao(r),
-		unionDao:    dao.NewUnionDao(r),
-		recordDao:   dao.NewRecordDao(r),
-		commonDao:   dao.NewCommonDao(r),
-		userService: service.NewUserService(r),
+		redisDao:     dao.NewRedisDao(r),
+		userDao:      dao.NewUserDao(r),
+		unionDao:     dao.NewUnionDao(r),
+		recordDao:    dao.NewRecordDao(r),
+		commonDao:    dao.NewCommonDao(r),
+		userService:  service.NewUserService(r),
+		unionService: service.NewUnionService(r),
 	}
 }
@@ -18,28 +18,20 @@ type UserHandler struct {
 	redisDao    *dao.RedisDao
 }
 
-func (h *UserHandler) UpdateUserAddress(session *remote.Session, msg []byte) any {
-	logs.Info("UpdateUserAddress stream:%v", string(msg))
-	var req request.UpdateUserAddressReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
-	err := h.userService.UpdateUserAddressByUid(session.GetUid(), req)
+func (h *UserHandler) UpdateUserAddress(session *remote.Session, req *request.UpdateUserAddressReq) any {
+	logs.Info("UpdateUserAddress req:%+v", req)
+	err := h.userService.UpdateUserAddressByUid(session.GetUid(), *req)
 	if err != nil {
 		return common.F(biz.SqlError)
 	}
 	res := response.UpdateUserAddressRes{}
 	res.Code = biz.OK
-	res.UpdateUserData = req
+	res.UpdateUserData = *req
 	return res
 }
 
-func (h *UserHandler) BindPhone(session *remote.Session, msg []byte) any {
+func (h *UserHandler) BindPhone(session *remote.Session, req *request.BindPhoneReq) any {
 	uid := session.GetUid()
-	var req request.BindPhoneReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
 	if !h.redisDao.CheckSmsCode(req.Phone, req.SmsCode) {
 		//验证码错误
 		return common.F(biz.SmsCodeError)
@@ -53,12 +45,8 @@ func (h *UserHandler) BindPhone(session *remote.Session, msg []byte) any {
 	return res
 }
 
-func (h *UserHandler) AuthRealName(session *remote.Session, msg []byte) any {
+func (h *UserHandler) AuthRealName(session *remote.Session, req *request.AuthRealNameReq) any {
 	uid := session.GetUid()
-	var req request.AuthRealNameReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
 	realNameInfo, _ := json.Marshal(req)
 	err := h.userService.UpdateUserRealName(uid, string(realNameInfo))
 	if err != nil {
@@ -70,11 +58,7 @@ func (h *UserHandler) AuthRealName(session *remote.Session, msg []byte) any {
 	return res
 }
 
-func (h *UserHandler) SearchByPhone(session *remote.Session, msg []byte) any {
-	var req request.SearchReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UserHandler) SearchByPhone(session *remote.Session, req *request.SearchReq) any {
 	user, err := h.userService.GetUserData(req.Phone, "")
 	if err != nil {
 		return common.F(err)
@@ -84,11 +68,7 @@ func (h *UserHandler) SearchByPhone(session *remote.Session, msg []byte) any {
 	})
 }
 
-func (h *UserHandler) SearchUserData(session *remote.Session, msg []byte) any {
-	var req request.SearchReq
-	if err := json.Unmarshal(msg, &req); err != nil {
-		return common.F(biz.RequestDataError)
-	}
+func (h *UserHandler) SearchUserData(session *remote.Session, req *request.SearchReq) any {
 	user, err := h.userService.GetUserData("", req.Uid)
 	if err != nil {
 		return common.F(err)
@@ -7,44 +7,44 @@ type CreateUnionReq struct {
 }
 
 type JoinUnionReq struct {
-	InviteID string `json:"inviteID"`
+	InviteID string `json:"inviteID" validate:"required"`
 }
 
 type MemberListReq struct {
-	UnionID    int64  `json:"unionID"`
+	UnionID    int64  `json:"unionID" validate:"gt=0"`
 	MatchData  bson.M `json:"matchData"`
 	StartIndex int    `json:"startIndex"`
 	Count      int    `json:"count"`
 }
 type ExitUnionReq struct {
-	UnionID int64 `json:"unionID"`
+	UnionID int64 `json:"unionID" validate:"gt=0"`
 }
 type MemberStatisticsInfoReq struct {
-	UnionID   int64  `json:"unionID"`
+	UnionID   int64  `json:"unionID" validate:"gt=0"`
 	MatchData bson.M `json:"matchData"`
 }
 type MemberScoreReq struct {
-	UnionID    int64  `json:"unionID"`
+	UnionID    int64  `json:"unionID" validate:"gt=0"`
 	MatchData  bson.M `json:"matchData"`
 	StartIndex int    `json:"startIndex"`
 	Count      int    `json:"count"`
 }
 
 type SafeBoxOperation struct {
-	UnionID    int64 `json:"unionID"`
+	UnionID    int64 `json:"unionID" validate:"gt=0"`
 	StartIndex int   `json:"startIndex"`
 	Count      int   `json:"count"`
 }
 
 type ModifyScoreReq struct {
-	UnionID   int64  `json:"unionID"`
-	Count     int    `json:"count"`
-	MemberUid string `json:"memberUid"`
+	UnionID   int64  `json:"unionID" validate:"gt=0"`
+	Count     int    `json:"count" validate:"gt=0"`
+	MemberUid string `json:"memberUid" validate:"required"`
 }
 
 type AddPartnerReq struct {
 	UnionID   int64  `json:"unionID"`
-	MemberUid string `json:"memberUid"`
+	MemberUid string `json:"memberUid" validate:"required"`
 }
 type GetScoreModifyRecordReq struct {
 	UnionID    int64  `json:"unionID"`
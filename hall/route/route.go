@@ -9,37 +9,37 @@ import (
 func Register(r *repo.Manager) node.LogicHandler {
 	handlers := make(node.LogicHandler)
 	userHandler := handler.NewUserHandler(r)
-	handlers["userHandler.updateUserAddress"] = userHandler.UpdateUserAddress
-	handlers["userHandler.bindPhone"] = userHandler.BindPhone
-	handlers["userHandler.authRealName"] = userHandler.AuthRealName
-	handlers["userHandler.searchByPhone"] = userHandler.SearchByPhone
-	handlers["userHandler.searchUserData"] = userHandler.SearchUserData
+	node.Handle(handlers, "userHandler.updateUserAddress", userHandler.UpdateUserAddress)
+	node.Handle(handlers, "userHandler.bindPhone", userHandler.BindPhone)
+	node.Handle(handlers, "userHandler.authRealName", userHandler.AuthRealName)
+	node.Handle(handlers, "userHandler.searchByPhone", userHandler.SearchByPhone)
+	node.Handle(handlers, "userHandler.searchUserData", userHandler.SearchUserData)
 	unionHandler := handler.NewUnionHandler(r)
-	handlers["unionHandler.createUnion"] = unionHandler.CreateUnion
-	handlers["unionHandler.getUserUnionList"] = unionHandler.GetUserUnionList
-	handlers["unionHandler.joinUnion"] = unionHandler.JoinUnion
-	handlers["unionHandler.exitUnion"] = unionHandler.ExitUnion
-	handlers["unionHandler.getMemberList"] = unionHandler.GetMemberList
-	handlers["unionHandler.getMemberStatisticsInfo"] = unionHandler.GetMemberStatisticsInfo
-	handlers["unionHandler.getMemberScoreList"] = unionHandler.GetMemberScoreList
-	handlers["unionHandler.safeBoxOperation"] = unionHandler.SafeBoxOperation
-	handlers["unionHandler.safeBoxOperationRecord"] = unionHandler.SafeBoxOperationRecord
-	handlers["unionHandler.modifyScore"] = unionHandler.ModifyScore
-	handlers["unionHandler.addPartner"] = unionHandler.AddPartner
-	handlers["unionHandler.getScoreModifyRecord"] = unionHandler.GetScoreModifyRecord
-	handlers["unionHandler.inviteJoinUnion"] = unionHandler.InviteJoinUnion
-	handlers["unionHandler.operationInviteJoinUnion"] = unionHandler.OperationInviteJoinUnion
-	handlers["unionHandler.updateUnionRebate"] = unionHandler.UpdateUnionRebate
-	handlers["unionHandler.updateUnionNotice"] = unionHandler.UpdateUnionNotice
-	handlers["unionHandler.giveScore"] = unionHandler.GiveScore
-	handlers["unionHandler.getGiveScoreRecord"] = unionHandler.GetGiveScoreRecord
-	handlers["unionHandler.getUnionRebateRecord"] = unionHandler.GetUnionRebateRecord
-	handlers["unionHandler.getGameRecord"] = unionHandler.GetGameRecord
-	handlers["unionHandler.getVideoRecord"] = unionHandler.GetVideoRecord
-	handlers["unionHandler.updateForbidGameStatus"] = unionHandler.UpdateForbidGameStatus
-	handlers["unionHandler.getRank"] = unionHandler.GetRank
-	handlers["unionHandler.getRankSingleDraw"] = unionHandler.GetRankSingleDraw
+	node.Handle(handlers, "unionHandler.createUnion", unionHandler.CreateUnion)
+	handlers.Register("unionHandler.getUserUnionList", unionHandler.GetUserUnionList)
+	node.Handle(handlers, "unionHandler.joinUnion", unionHandler.JoinUnion)
+	node.Handle(handlers, "unionHandler.exitUnion", unionHandler.ExitUnion)
+	node.Handle(handlers, "unionHandler.getMemberList", unionHandler.GetMemberList)
+	node.Handle(handlers, "unionHandler.getMemberStatisticsInfo", unionHandler.GetMemberStatisticsInfo)
+	node.Handle(handlers, "unionHandler.getMemberScoreList", unionHandler.GetMemberScoreList)
+	node.Handle(handlers, "unionHandler.safeBoxOperation", unionHandler.SafeBoxOperation)
+	node.Handle(handlers, "unionHandler.safeBoxOperationRecord", unionHandler.SafeBoxOperationRecord)
+	node.Handle(handlers, "unionHandler.modifyScore", unionHandler.ModifyScore)
+	node.Handle(handlers, "unionHandler.addPartner", unionHandler.AddPartner)
+	node.Handle(handlers, "unionHandler.getScoreModifyRecord", unionHandler.GetScoreModifyRecord)
+	node.Handle(handlers, "unionHandler.inviteJoinUnion", unionHandler.InviteJoinUnion)
+	node.Handle(handlers, "unionHandler.operationInviteJoinUnion", unionHandler.OperationInviteJoinUnion)
+	node.Handle(handlers, "unionHandler.updateUnionRebate", unionHandler.UpdateUnionRebate)
+	node.Handle(handlers, "unionHandler.updateUnionNotice", unionHandler.UpdateUnionNotice)
+	node.Handle(handlers, "unionHandler.giveScore", unionHandler.GiveScore)
+	node.Handle(handlers, "unionHandler.getGiveScoreRecord", unionHandler.GetGiveScoreRecord)
+	node.Handle(handlers, "unionHandler.getUnionRebateRecord", unionHandler.GetUnionRebateRecord)
+	node.Handle(handlers, "unionHandler.getGameRecord", unionHandler.GetGameRecord)
+	node.Handle(handlers, "unionHandler.getVideoRecord", unionHandler.GetVideoRecord)
+	node.Handle(handlers, "unionHandler.updateForbidGameStatus", unionHandler.UpdateForbidGameStatus)
+	node.Handle(handlers, "unionHandler.getRank", unionHandler.GetRank)
+	node.Handle(handlers, "unionHandler.getRankSingleDraw", unionHandler.GetRankSingleDraw)
 	gameHandler := handler.NewGameHandler(r)
-	handlers["gameHandler.joinRoom"] = gameHandler.JoinRoom
+	node.Handle(handlers, "gameHandler.joinRoom", gameHandler.JoinRoom)
 	return handlers
 }
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"common/config"
+	"common/logs"
+	"common/trace"
+	connectorApp "connector/app"
+	"context"
+	"core/repo"
+	"framework/game"
+	"framework/node"
+	"framework/remote"
+	gameApp "game/app"
+	hallApp "hall/app"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Run 在一个进程中启动servers.json中的所有connector hall game 节点之间通过remote.LocalBus通信
+func Run(ctx context.Context) error {
+	logs.InitLog(config.Conf.AppName)
+	shutdownTrace, err := trace.Init(config.Conf.AppName, config.Conf.Trace)
+	if err != nil {
+		logs.Error("init trace err:%v", err)
+		return err
+	}
+	bus := remote.NewLocalBus()
+	manager := repo.New()
+	var closers []func()
+	exit := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+	//先启动节点 connector启动时会向节点查询路由
+	for _, v := range game.Conf.ServersConf.Servers {
+		var n *node.App
+		switch v.ServerType {
+		case "hall":
+			n = hallApp.NewNode(manager)
+		case "game":
+			n = gameApp.NewNode(manager)
+		default:
+			logs.Warn("standalone unsupported server type:%s, serverId=%s", v.ServerType, v.ID)
+			continue
+		}
+		n.SetClientBuilder(bus.Builder())
+		if err := n.Run(v.ID); err != nil {
+			exit()
+			return err
+		}
+		closers = append(closers, n.Shutdown)
+	}
+	for _, v := range game.Conf.ServersConf.Connector {
+		c := connectorApp.NewConnector(manager)
+		c.SetClientBuilder(bus.Builder())
+		closers = append(closers, c.Close)
+		go c.Run(v.ID, config.Conf.Server.MaxConn)
+	}
+	stop := func() {
+		exit()
+		time.Sleep(3 * time.Second)
+		shutdownTrace()
+		logs.Info("stop app finish")
+	}
+	//期望有一个优雅启停 遇到中断 退出 终止 挂断
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGHUP)
+	for {
+		select {
+		case <-ctx.Done():
+			stop()
+			//time out
+			return nil
+		case s := <-c:
+			switch s {
+			case syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT:
+				stop()
+				logs.Info("standalone app quit")
+				return nil
+			case syscall.SIGHUP:
+				stop()
+				logs.Info("hang up!! standalone app quit")
+				return nil
+			default:
+				return nil
+			}
+		}
+	}
+}
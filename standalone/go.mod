@@ -0,0 +1,3 @@
+module standalone
+
+go 1.21.0
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"common/config"
+	"common/metrics"
+	"context"
+	"fmt"
+	"framework/game"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"standalone/app"
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "standalone",
+	Short: "standalone 单进程运行connector hall game",
+	Long:  `standalone 单进程运行connector hall game 节点之间通过进程内的消息总线通信 不需要nats 用于本地开发和集成测试`,
+	Run: func(cmd *cobra.Command, args []string) {
+	},
+	PostRun: func(cmd *cobra.Command, args []string) {
+	},
+}
+
+var (
+	configFile    string
+	gameConfigDir string
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&configFile, "config", "application.yml", "app config yml file")
+	rootCmd.Flags().StringVar(&gameConfigDir, "gameDir", "../config", "game config dir")
+}
+
+func main() {
+	//1.加载配置
+	if err := rootCmd.Execute(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	config.InitConfig(configFile)
+	game.InitConfig(gameConfigDir)
+	//2.启动监控
+	go func() {
+		err := metrics.Serve(fmt.Sprintf("0.0.0.0:%d", config.Conf.MetricPort))
+		if err != nil {
+			panic(err)
+		}
+	}()
+	//3.启动servers.json中配置的所有connector hall game
+	err := app.Run(context.Background())
+	if err != nil {
+		log.Println(err)
+		os.Exit(-1)
+	}
+}